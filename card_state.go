@@ -0,0 +1,202 @@
+package genanki
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CardFlag is the colour flag of a card
+type CardFlag int
+
+const (
+	FlagNone      CardFlag = 0
+	FlagRed       CardFlag = 1
+	FlagOrange    CardFlag = 2
+	FlagGreen     CardFlag = 3
+	FlagBlue      CardFlag = 4
+	FlagPink      CardFlag = 5
+	FlagTurquoise CardFlag = 6
+	FlagPurple    CardFlag = 7
+)
+
+// Anki's limits on card custom data
+const (
+	maxCustomDataKeyLength = 8
+	maxCustomDataLength    = 100
+)
+
+// Suspend suspends the cards with the given ordinals, or every card of the
+// note if none are given
+func (n *Note) Suspend(ords ...int) *Note {
+	if len(ords) == 0 {
+		n.Suspended = true
+		return n
+	}
+	for _, ord := range ords {
+		n.scheduleFor(ord).Queue = QueueSuspended
+	}
+	return n
+}
+
+// Bury buries the cards with the given ordinals until the next day, or every
+// card of the note if none are given. Collections are written for the v1
+// scheduler, whose only buried queue is QueueBuried; Anki moves these cards
+// to QueueUserBuried when it upgrades to a later scheduler.
+func (n *Note) Bury(ords ...int) *Note {
+	if len(ords) == 0 {
+		n.Buried = true
+		return n
+	}
+	for _, ord := range ords {
+		n.scheduleFor(ord).Queue = QueueBuried
+	}
+	return n
+}
+
+// SetFlag flags the cards with the given ordinals, or every card of the note
+// if none are given
+func (n *Note) SetFlag(flag CardFlag, ords ...int) *Note {
+	if len(ords) == 0 {
+		n.Flag = flag
+		return n
+	}
+	for _, ord := range ords {
+		n.scheduleFor(ord).Flag = flag
+	}
+	return n
+}
+
+// SetCustomData sets a custom data entry, readable by custom scheduling code,
+// on the cards with the given ordinals, or every card of the note if none are
+// given. Anki limits keys to 8 bytes and the encoded data to 100 bytes.
+func (n *Note) SetCustomData(key, value string, ords ...int) *Note {
+	if len(ords) == 0 {
+		if n.CustomData == nil {
+			n.CustomData = make(map[string]string)
+		}
+		n.CustomData[key] = value
+		return n
+	}
+	for _, ord := range ords {
+		schedule := n.scheduleFor(ord)
+		if schedule.CustomData == nil {
+			schedule.CustomData = make(map[string]string)
+		}
+		schedule.CustomData[key] = value
+	}
+	return n
+}
+
+// Suspend suspends every card of the notes in the deck so far; notes added
+// afterwards are left alone
+func (d *Deck) Suspend() *Deck {
+	for _, note := range d.Notes {
+		note.Suspend()
+	}
+	return d
+}
+
+// Bury buries every card of the notes in the deck so far until the next day
+func (d *Deck) Bury() *Deck {
+	for _, note := range d.Notes {
+		note.Bury()
+	}
+	return d
+}
+
+// SetFlag flags every card of the notes in the deck so far
+func (d *Deck) SetFlag(flag CardFlag) *Deck {
+	for _, note := range d.Notes {
+		note.SetFlag(flag)
+	}
+	return d
+}
+
+// SetCustomData sets a custom data entry on every card of the notes in the
+// deck so far
+func (d *Deck) SetCustomData(key, value string) *Deck {
+	for _, note := range d.Notes {
+		note.SetCustomData(key, value)
+	}
+	return d
+}
+
+// scheduleFor returns the schedule of the card with the given ordinal,
+// creating a new-card schedule if it has none
+func (n *Note) scheduleFor(ord int) *CardSchedule {
+	schedule := n.Schedules[ord]
+	if schedule == nil {
+		schedule = &CardSchedule{}
+		n.SetSchedule(ord, schedule)
+	}
+	return schedule
+}
+
+// hasCardState reports whether any card of the note differs from a plain new card
+func (n *Note) hasCardState() bool {
+	return len(n.Schedules) > 0 || n.Suspended || n.Buried || n.Flag != FlagNone || len(n.CustomData) > 0
+}
+
+// cardState returns the state the card with the given ordinal is created
+// with: its own schedule, completed with the note-wide settings and the
+// new-card position
+func (n *Note) cardState(ord int, position int64) *CardSchedule {
+	state := CardSchedule{}
+	if schedule := n.Schedules[ord]; schedule != nil {
+		state = *schedule
+	}
+
+	if state.Type == CardTypeNew && state.Position == 0 {
+		state.Position = position
+	}
+	if state.Queue == QueueNew {
+		if n.Suspended {
+			state.Queue = QueueSuspended
+		} else if n.Buried {
+			state.Queue = QueueBuried
+		}
+	}
+	if state.Flag == FlagNone {
+		state.Flag = n.Flag
+	}
+	if len(n.CustomData) > 0 {
+		data := make(map[string]string, len(n.CustomData)+len(state.CustomData))
+		for key, value := range n.CustomData {
+			data[key] = value
+		}
+		for key, value := range state.CustomData {
+			data[key] = value
+		}
+		state.CustomData = data
+	}
+
+	return &state
+}
+
+// cardData encodes custom data as the JSON stored in cards.data, where Anki
+// keeps it as a JSON string under "cd"
+func cardData(customData map[string]string) (string, error) {
+	if len(customData) == 0 {
+		return "{}", nil
+	}
+
+	for key := range customData {
+		if len(key) == 0 || len(key) > maxCustomDataKeyLength {
+			return "", fmt.Errorf("custom data key %q must be 1 to %d bytes", key, maxCustomDataKeyLength)
+		}
+	}
+
+	encoded, err := json.Marshal(customData)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal custom data: %v", err)
+	}
+	if len(encoded) > maxCustomDataLength {
+		return "", fmt.Errorf("custom data is %d bytes, Anki allows at most %d", len(encoded), maxCustomDataLength)
+	}
+
+	data, err := json.Marshal(map[string]string{"cd": string(encoded)})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal card data: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,148 @@
+package genanki
+
+import (
+	"fmt"
+	"sort"
+)
+
+// cardOrdinals returns the template ordinals that produce a card for note.
+// A template yields a card when its question side would render some field
+// content, which is the rule Anki itself uses to skip empty cards.
+func cardOrdinals(model *Model, note *Note) ([]int, error) {
+	if getModelType(model) == 1 {
+		return clozeCardOrdinals(model, note)
+	}
+
+	nonempty := nonemptyFields(model, note)
+
+	ords := make([]int, 0, len(model.Templates))
+	for _, template := range model.Templates {
+		nodes, err := parseTemplate(template.Qfmt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %q of model %q: %v", template.Name, model.Name, err)
+		}
+		if !templateIsEmpty(nodes, nonempty, true) {
+			ords = append(ords, template.Ord)
+		}
+	}
+
+	if len(ords) == 0 {
+		return nil, fmt.Errorf("note %d would not generate any cards with model %q", note.ID, model.Name)
+	}
+
+	return ords, nil
+}
+
+// clozeCardOrdinals returns one ordinal per distinct cloze number found in the
+// fields the model's templates render through the cloze filter, using
+// ord = n-1 as Anki does.
+func clozeCardOrdinals(model *Model, note *Note) ([]int, error) {
+	clozeFields, err := clozeFieldNames(model)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	for i, field := range model.Fields {
+		if !clozeFields[field.Name] || i >= len(note.Fields) {
+			continue
+		}
+		collectClozeOrds(parseCloze(note.Fields[i]), seen)
+	}
+
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("cloze note %d has no cloze deletions", note.ID)
+	}
+
+	ords := make([]int, 0, len(seen))
+	for ord := range seen {
+		ords = append(ords, ord)
+	}
+	sort.Ints(ords)
+
+	return ords, nil
+}
+
+// collectClozeOrds records the card ordinal of every deletion in nodes
+func collectClozeOrds(nodes []clozeNode, seen map[int]bool) {
+	for _, node := range nodes {
+		if node.ord > 0 {
+			seen[node.ord-1] = true
+			collectClozeOrds(node.children, seen)
+		}
+	}
+}
+
+// clozeFieldNames returns the fields referenced with the cloze filter in any
+// of the model's templates
+func clozeFieldNames(model *Model) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for _, template := range model.Templates {
+		for _, format := range []string{template.Qfmt, template.Afmt} {
+			nodes, err := parseTemplate(format)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse template %q of model %q: %v", template.Name, model.Name, err)
+			}
+			collectClozeFields(nodes, names)
+		}
+	}
+	return names, nil
+}
+
+func collectClozeFields(nodes []templateNode, names map[string]bool) {
+	for _, node := range nodes {
+		if node.kind != replacementNode {
+			collectClozeFields(node.children, names)
+			continue
+		}
+		for _, filter := range node.filters {
+			if filter == "cloze" {
+				names[node.key] = true
+			}
+		}
+	}
+}
+
+// modelRequirements computes the "req" entry Anki stores for every template of
+// a model. Each entry is [ord, "any"|"all"|"none", [field ords]]: a template
+// with an "any" requirement renders when at least one of the listed fields is
+// non-empty, and an "all" requirement needs every listed field.
+func modelRequirements(model *Model) ([]interface{}, error) {
+	reqs := make([]interface{}, 0, len(model.Templates))
+
+	for _, template := range model.Templates {
+		nodes, err := parseTemplate(template.Qfmt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %q of model %q: %v", template.Name, model.Name, err)
+		}
+
+		anyFields := make([]int, 0)
+		for _, field := range model.Fields {
+			if !templateIsEmpty(nodes, map[string]bool{field.Name: true}, false) {
+				anyFields = append(anyFields, field.Ord)
+			}
+		}
+		if len(anyFields) > 0 {
+			reqs = append(reqs, []interface{}{template.Ord, "any", anyFields})
+			continue
+		}
+
+		allFields := make([]int, 0)
+		for _, field := range model.Fields {
+			nonempty := make(map[string]bool, len(model.Fields))
+			for _, other := range model.Fields {
+				nonempty[other.Name] = other.Name != field.Name
+			}
+			if templateIsEmpty(nodes, nonempty, false) {
+				allFields = append(allFields, field.Ord)
+			}
+		}
+		if len(allFields) > 0 {
+			reqs = append(reqs, []interface{}{template.Ord, "all", allFields})
+		} else {
+			reqs = append(reqs, []interface{}{template.Ord, "none", []int{}})
+		}
+	}
+
+	return reqs, nil
+}
@@ -0,0 +1,192 @@
+package genanki
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// clozeNode is either plain text or a cloze deletion with nested content
+type clozeNode struct {
+	text     string
+	ord      int // 0 for plain text
+	hint     string
+	children []clozeNode
+}
+
+// parseCloze splits text into plain text and (possibly nested) cloze deletions.
+// Deletions that are never closed are kept as literal text.
+func parseCloze(text string) []clozeNode {
+	type openCloze struct {
+		node    clozeNode
+		opening string
+		inHint  bool
+	}
+
+	root := make([]clozeNode, 0)
+	stack := make([]*openCloze, 0)
+
+	appendNode := func(node clozeNode) {
+		if len(stack) == 0 {
+			root = append(root, node)
+			return
+		}
+		top := stack[len(stack)-1]
+		top.node.children = append(top.node.children, node)
+	}
+	appendText := func(s string) {
+		if len(stack) > 0 && stack[len(stack)-1].inHint {
+			stack[len(stack)-1].node.hint += s
+			return
+		}
+		appendNode(clozeNode{text: s})
+	}
+
+	for len(text) > 0 {
+		if ord, n := clozeOpening(text); n > 0 {
+			stack = append(stack, &openCloze{node: clozeNode{ord: ord}, opening: text[:n]})
+			text = text[n:]
+			continue
+		}
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if strings.HasPrefix(text, "}}") {
+				stack = stack[:len(stack)-1]
+				appendNode(top.node)
+				text = text[2:]
+				continue
+			}
+			if !top.inHint && strings.HasPrefix(text, "::") {
+				top.inHint = true
+				text = text[2:]
+				continue
+			}
+		}
+
+		next := 1
+		if idx := strings.IndexAny(text[1:], "{}:"); idx >= 0 {
+			next = idx + 1
+		} else {
+			next = len(text)
+		}
+		appendText(text[:next])
+		text = text[next:]
+	}
+
+	// Unwind deletions that were never closed back into literal text
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		appendText(top.opening)
+		for _, child := range top.node.children {
+			appendNode(child)
+		}
+		if top.inHint {
+			appendText("::" + top.node.hint)
+		}
+	}
+
+	return root
+}
+
+// clozeOpening returns the cloze number and length of a {{cN:: prefix of text
+func clozeOpening(text string) (int, int) {
+	if !strings.HasPrefix(text, "{{c") {
+		return 0, 0
+	}
+	i := 3
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	if i == 3 || !strings.HasPrefix(text[i:], "::") {
+		return 0, 0
+	}
+	ord, err := strconv.Atoi(text[3:i])
+	if err != nil {
+		return 0, 0
+	}
+	// Anki treats {{c0::...}} the same as {{c1::...}}
+	if ord < 1 {
+		ord = 1
+	}
+	return ord, i + 2
+}
+
+// clozeHasOrd reports whether nodes contain a deletion with the given number
+func clozeHasOrd(nodes []clozeNode, ord int) bool {
+	for _, node := range nodes {
+		if node.ord == ord || clozeHasOrd(node.children, ord) {
+			return true
+		}
+	}
+	return false
+}
+
+// clozeText returns the revealed text of nodes
+func clozeText(nodes []clozeNode) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		if node.ord == 0 {
+			sb.WriteString(node.text)
+		} else {
+			sb.WriteString(clozeText(node.children))
+		}
+	}
+	return sb.String()
+}
+
+// renderCloze renders a field through Anki's cloze filter. On the question
+// side deletions with number ord are hidden behind [...] or their hint; on the
+// answer side they are highlighted. Fields without deletion ord render empty.
+func renderCloze(text string, ord int, answer bool) string {
+	nodes := parseCloze(text)
+	if !clozeHasOrd(nodes, ord) {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeClozeNodes(&sb, nodes, ord, answer)
+	return sb.String()
+}
+
+func writeClozeNodes(sb *strings.Builder, nodes []clozeNode, ord int, answer bool) {
+	for _, node := range nodes {
+		switch {
+		case node.ord == 0:
+			sb.WriteString(node.text)
+		case node.ord == ord && !answer:
+			placeholder := "[...]"
+			if node.hint != "" {
+				placeholder = "[" + node.hint + "]"
+			}
+			fmt.Fprintf(sb, `<span class="cloze" data-cloze="%s" data-ordinal="%d">%s</span>`,
+				html.EscapeString(clozeText(node.children)), node.ord, placeholder)
+		case node.ord == ord:
+			fmt.Fprintf(sb, `<span class="cloze" data-ordinal="%d">`, node.ord)
+			writeClozeNodes(sb, node.children, ord, answer)
+			sb.WriteString("</span>")
+		default:
+			fmt.Fprintf(sb, `<span class="cloze-inactive" data-ordinal="%d">`, node.ord)
+			writeClozeNodes(sb, node.children, ord, answer)
+			sb.WriteString("</span>")
+		}
+	}
+}
+
+// clozeOnly returns the text of the deletions with number ord, joined by ", "
+func clozeOnly(text string, ord int) string {
+	answers := make([]string, 0)
+	var collect func(nodes []clozeNode)
+	collect = func(nodes []clozeNode) {
+		for _, node := range nodes {
+			if node.ord == ord {
+				answers = append(answers, clozeText(node.children))
+			} else if node.ord != 0 {
+				collect(node.children)
+			}
+		}
+	}
+	collect(parseCloze(text))
+	return strings.Join(answers, ", ")
+}
@@ -12,25 +12,84 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Database is an Anki collection. It holds a single SQLite connection, so it
+// may be shared between goroutines, whose calls run one at a time.
 type Database struct {
 	db    *sql.DB
 	debug bool
+	// sortFields caches the sort field index of each model added to the collection
+	sortFields map[int64]int
 }
 
-// newDatabase creates a new in-memory database instance
-func newDatabase() (*Database, error) {
-	db, err := sql.Open("sqlite3", ":memory:")
+// NewDatabase creates an empty in-memory collection
+func NewDatabase() (*Database, error) {
+	return openDatabase(":memory:")
+}
+
+// CreateDatabase creates an empty collection file at path, which must not
+// exist yet. Changes are written to the file as they are made.
+func CreateDatabase(path string) (*Database, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("collection %s already exists", path)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to check collection: %v", err)
+	}
+	return openDatabase(path)
+}
+
+// OpenDatabase opens an existing collection.anki2 file, such as one made by
+// CreateDatabase. Changes are written to the file as they are made.
+func OpenDatabase(path string) (*Database, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open collection: %v", err)
+	}
+
+	d, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A collection without a col row has had no models added yet
+	var ver int
+	err = d.db.QueryRow("SELECT ver FROM col WHERE id = 1").Scan(&ver)
+	if err != nil && err != sql.ErrNoRows {
+		d.Close()
+		return nil, fmt.Errorf("failed to read collection: %v", err)
+	}
+	if ver >= schema18Version {
+		d.Close()
+		return nil, fmt.Errorf("collection %s uses schema %d, only schema 11 collections can be opened", path, ver)
+	}
+
+	return d, nil
+}
+
+// openDatabase opens the SQLite database at path, creating the collection
+// tables it lacks
+func openDatabase(path string) (*Database, error) {
+	db, err := sql.Open(sqliteDriver, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
 
+	// Every connection to ":memory:" opens its own empty database, and the
+	// pragmas below only apply to the connection they run on, so the pool
+	// keeps a single connection
+	db.SetMaxOpenConns(1)
+
+	// Only in-memory collections can skip syncing, a file must survive a crash
+	synchronous := "NORMAL"
+	if path == ":memory:" {
+		synchronous = "OFF"
+	}
+
 	pragmas := []string{
 		"PRAGMA foreign_keys = ON",
 		"PRAGMA page_size = 4096",
 		"PRAGMA encoding = 'UTF-8'",
 		"PRAGMA legacy_file_format = OFF",
 		"PRAGMA journal_mode = DELETE",
-		"PRAGMA synchronous = OFF",
+		"PRAGMA synchronous = " + synchronous,
 		"PRAGMA temp_store = MEMORY",
 	}
 
@@ -41,7 +100,7 @@ func newDatabase() (*Database, error) {
 		}
 	}
 
-	d := &Database{db: db, debug: false}
+	d := &Database{db: db, debug: false, sortFields: make(map[int64]int)}
 	if err := d.initialize(); err != nil {
 		db.Close()
 		return nil, err
@@ -66,7 +125,7 @@ func (d *Database) initialize() error {
 			usn INTEGER NOT NULL,
 			tags TEXT NOT NULL,
 			flds TEXT NOT NULL,
-			sfld TEXT NOT NULL,
+			sfld INTEGER NOT NULL,
 			csum INTEGER NOT NULL,
 			flags INTEGER NOT NULL,
 			data TEXT NOT NULL
@@ -134,6 +193,10 @@ func (d *Database) initialize() error {
 }
 
 func (d *Database) AddModel(model *Model) (*Database, error) {
+	if model.SortFieldIndex < 0 || model.SortFieldIndex >= len(model.Fields) {
+		return nil, fmt.Errorf("model %q has invalid sort field index %d", model.Name, model.SortFieldIndex)
+	}
+
 	conf := map[string]interface{}{
 		"nextPos":              1,
 		"estTimes":             true,
@@ -158,21 +221,26 @@ func (d *Database) AddModel(model *Model) (*Database, error) {
 		return nil, fmt.Errorf("failed to marshal conf: %v", err)
 	}
 
+	reqs, err := modelRequirements(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute card requirements: %v", err)
+	}
+
 	modelConfig := map[string]interface{}{
 		"id":                model.ID,
 		"name":              model.Name,
 		"type":              getModelType(model), // 0 for basic, 1 for cloze
 		"mod":               0,
 		"usn":               0,
-		"sortf":             0, // Sort by first field
+		"sortf":             model.SortFieldIndex,
 		"did":               1, // Default deck ID
 		"vers":              []interface{}{},
 		"tags":              []interface{}{},
 		"css":               model.CSS,
-		"latexPre":          "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
-		"latexPost":         "\\end{document}",
+		"latexPre":          defaultLatexPre,
+		"latexPost":         defaultLatexPost,
 		"latexsvg":          false,
-		"req":               []interface{}{[]interface{}{0, "all", []interface{}{0}}},
+		"req":               reqs,
 		"flds":              getFieldsConfig(model),
 		"tmpls":             getTemplatesConfig(model),
 		"originalStockKind": 1,
@@ -213,62 +281,7 @@ func (d *Database) AddModel(model *Model) (*Database, error) {
 
 	// Set up deck configuration
 	deckConf := map[string]interface{}{
-		"1": map[string]interface{}{
-			"id":       1,
-			"mod":      time.Now().Unix(),
-			"name":     "Default",
-			"usn":      -1,
-			"maxTaken": 60,
-			"autoplay": true,
-			"timer":    0,
-			"replayq":  true,
-			"new": map[string]interface{}{
-				"delays":        []float64{1.0, 10.0},
-				"ints":          []int{1, 4, 7},
-				"initialFactor": 2500,
-				"separate":      true,
-				"order":         0,
-				"perDay":        20,
-				"bury":          false,
-			},
-			"rev": map[string]interface{}{
-				"perDay":     100,
-				"ivlFct":     1.0,
-				"ease4":      1.3,
-				"fuzz":       0.05,
-				"minSpace":   1,
-				"hardFactor": 1.2,
-				"bury":       false,
-			},
-			"lapse": map[string]interface{}{
-				"delays":      []float64{10.0},
-				"mult":        0.0,
-				"minInt":      1,
-				"leechFails":  8,
-				"leechAction": 1,
-			},
-			"dyn":                     false,
-			"newMix":                  0,
-			"newPerDayMinimum":        0,
-			"interdayLearningMix":     0,
-			"reviewOrder":             0,
-			"newSortOrder":            0,
-			"newGatherPriority":       0,
-			"buryInterdayLearning":    false,
-			"fsrsWeights":             []interface{}{},
-			"fsrsParams5":             []interface{}{},
-			"desiredRetention":        0.9,
-			"ignoreRevlogsBeforeDate": "",
-			"easyDaysPercentages":     []float64{1.0, 1.0, 1.0, 1.0, 1.0, 1.0, 1.0},
-			"stopTimerOnAnswer":       false,
-			"secondsToShowQuestion":   0.0,
-			"secondsToShowAnswer":     0.0,
-			"questionAction":          0,
-			"answerAction":            0,
-			"waitForAudio":            true,
-			"sm2Retention":            0.9,
-			"weightSearch":            "",
-		},
+		fmt.Sprintf("%d", defaultDeckOptionsID): DefaultDeckOptions().config(),
 	}
 
 	deckConfJSON, err := json.Marshal(deckConf)
@@ -310,14 +323,29 @@ func (d *Database) AddModel(model *Model) (*Database, error) {
 		return nil, fmt.Errorf("failed to update models: %v", err)
 	}
 
+	d.sortFields[model.ID] = model.SortFieldIndex
+
 	return d, nil
 }
 
 func (d *Database) AddDeck(deck *Deck) (*Database, error) {
-	deckConfig := map[string]interface{}{
+	name, err := NormalizeDeckName(deck.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.putDeck(deck.ID, newDeckConfig(deck, name)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newDeckConfig returns the col.decks entry of a regular deck
+func newDeckConfig(deck *Deck, name string) map[string]interface{} {
+	return map[string]interface{}{
 		"id":               deck.ID,
 		"mod":              time.Now().Unix(),
-		"name":             deck.Name,
+		"name":             name,
 		"usn":              -1,
 		"lrnToday":         []int{0, 0},
 		"revToday":         []int{0, 0},
@@ -327,15 +355,18 @@ func (d *Database) AddDeck(deck *Deck) (*Database, error) {
 		"browserCollapsed": false,
 		"desc":             deck.Desc,
 		"dyn":              0,
-		"conf":             1,
+		"conf":             deck.optionsID(),
 		"extendNew":        10,
 		"extendRev":        50,
 	}
+}
 
+// putDeck adds or replaces a deck entry in col.decks
+func (d *Database) putDeck(id int64, deckConfig map[string]interface{}) error {
 	var decksJSON string
 	err := d.db.QueryRow("SELECT decks FROM col WHERE id = 1").Scan(&decksJSON)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read decks: %v", err)
+		return fmt.Errorf("failed to read decks: %v", err)
 	}
 
 	var decks map[string]interface{}
@@ -343,21 +374,22 @@ func (d *Database) AddDeck(deck *Deck) (*Database, error) {
 		decks = make(map[string]interface{})
 	}
 
-	decks[fmt.Sprintf("%d", deck.ID)] = deckConfig
+	decks[fmt.Sprintf("%d", id)] = deckConfig
 
 	newDecksJSON, err := json.Marshal(decks)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal decks: %v", err)
+		return fmt.Errorf("failed to marshal decks: %v", err)
 	}
 
 	_, err = d.db.Exec("UPDATE col SET decks = ? WHERE id = 1", string(newDecksJSON))
-	if err != nil {
-		return nil, err
-	}
-	return d, nil
+	return err
 }
 
 func (d *Database) AddNote(note *Note) (*Database, error) {
+	if len(note.Fields) == 0 {
+		return nil, fmt.Errorf("note %d has no fields", note.ID)
+	}
+
 	tags := formatAnkiTags(note.Tags)
 
 	fields := make([]byte, 0)
@@ -369,13 +401,19 @@ func (d *Database) AddNote(note *Note) (*Database, error) {
 	}
 	fieldsStr := string(fields)
 
-	csum := int64(0)
-	if len(note.Fields) > 0 {
-		for _, c := range note.Fields[0] {
-			csum = (csum + int64(c)) % 0xffff
-		}
+	sortIdx, err := d.sortFieldIndex(note.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	if sortIdx >= len(note.Fields) {
+		return nil, fmt.Errorf("note %d has no field for sort field index %d", note.ID, sortIdx)
 	}
 
+	// Anki's duplicate check compares the checksum of the first field, whatever
+	// the model's sort field is
+	sortField := sortFieldText(note.Fields[sortIdx])
+	csum := fieldChecksum(note.Fields[0])
+
 	noteData := map[string]interface{}{
 		"tags": note.Tags,
 	}
@@ -388,18 +426,25 @@ func (d *Database) AddNote(note *Note) (*Database, error) {
 		log.Printf("Note fields string: %q", fieldsStr)
 	}
 
+	// Notes without an explicit GUID get one derived from their fields, like
+	// python genanki, so rebuilding a deck updates notes instead of duplicating them
+	guid := note.GUID
+	if guid == "" {
+		guid = GuidFor(note.Fields...)
+	}
+
 	_, err = d.db.Exec(`
 		INSERT INTO notes (id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		note.ID,
-		fmt.Sprintf("%x", note.ID),
+		guid,
 		note.ModelID,
 		note.Modified.Unix(),
 		-1,
 		tags,
 		fieldsStr,
-		note.Fields[0],
+		sortFieldValue(sortField),
 		csum,
 		0,
 		string(noteDataJSON),
@@ -421,6 +466,34 @@ func (d *Database) AddNote(note *Note) (*Database, error) {
 	return d, nil
 }
 
+// sortFieldIndex returns the sort field index of the model with the given ID,
+// reading it from the collection for models that were not added through AddModel
+func (d *Database) sortFieldIndex(modelID int64) (int, error) {
+	if idx, ok := d.sortFields[modelID]; ok {
+		return idx, nil
+	}
+
+	var modelsJSON string
+	if err := d.db.QueryRow("SELECT models FROM col WHERE id = 1").Scan(&modelsJSON); err != nil {
+		return 0, fmt.Errorf("failed to read models: %v", err)
+	}
+
+	var models map[string]struct {
+		SortField int `json:"sortf"`
+	}
+	if err := json.Unmarshal([]byte(modelsJSON), &models); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal models: %v", err)
+	}
+
+	model, ok := models[fmt.Sprintf("%d", modelID)]
+	if !ok {
+		return 0, fmt.Errorf("unknown model %d", modelID)
+	}
+	d.sortFields[modelID] = model.SortField
+
+	return model.SortField, nil
+}
+
 func formatAnkiTags(tags []string) string {
 	if len(tags) == 0 {
 		return ""
@@ -436,37 +509,9 @@ func formatAnkiTags(tags []string) string {
 	return " " + joined + " "
 }
 
+// AddCard adds a new card for the note's template (or cloze) ordinal
 func (d *Database) AddCard(noteID, deckID int64, templateOrd int) (*Database, error) {
-	now := time.Now().Unix()
-	_, err := d.db.Exec(`
-		INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`,
-		GenerateIntID(),
-		noteID,
-		deckID,
-		templateOrd,
-		now,
-		-1,
-		0,    // new card
-		0,    // new queue
-		0,    // due today
-		0,    // initial interval
-		2500, // initial factor
-		0,    // no reps yet
-		0,    // no lapses yet
-		0,    // no cards left
-		0,    // no original due date
-		0,    // no original deck
-		0,    // no flags
-		"{}",
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return d, nil
+	return d.AddScheduledCard(noteID, deckID, templateOrd, nil)
 }
 
 func (d *Database) Close() error {
@@ -0,0 +1,278 @@
+package genanki
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// defaultDeckOptionsID is the ID of Anki's built-in "Default" option group
+const defaultDeckOptionsID = 1
+
+// LeechAction is what Anki does with a card that reaches the leech threshold
+type LeechAction int
+
+const (
+	LeechSuspend LeechAction = 0
+	LeechTagOnly LeechAction = 1
+)
+
+// DeckOptions is an Anki deck option group ("preset"), shared by every deck
+// that uses it
+type DeckOptions struct {
+	ID   int64
+	Name string
+
+	NewPerDay     int
+	ReviewsPerDay int
+
+	// LearningSteps and RelearningSteps are in minutes
+	LearningSteps      []float64
+	RelearningSteps    []float64
+	GraduatingInterval int // days
+	EasyInterval       int // days
+	InitialEase        int // permille, 2500 = 250%
+	MaximumInterval    int // days
+
+	BuryNew              bool
+	BuryReviews          bool
+	BuryInterdayLearning bool
+
+	LeechThreshold int
+	LeechAction    LeechAction
+
+	// DesiredRetention and FSRSParams are used when FSRS is enabled. FSRSParams
+	// may hold 17 (FSRS 4.5), 19 (FSRS 5) or 21 (FSRS 6) parameters.
+	DesiredRetention float64
+	FSRSParams       []float64
+}
+
+// DefaultDeckOptions returns Anki's "Default" option group
+func DefaultDeckOptions() *DeckOptions {
+	return &DeckOptions{
+		ID:                 defaultDeckOptionsID,
+		Name:               "Default",
+		NewPerDay:          20,
+		ReviewsPerDay:      100,
+		LearningSteps:      []float64{1, 10},
+		RelearningSteps:    []float64{10},
+		GraduatingInterval: 1,
+		EasyInterval:       4,
+		InitialEase:        2500,
+		MaximumInterval:    36500,
+		LeechThreshold:     8,
+		LeechAction:        LeechTagOnly,
+		DesiredRetention:   0.9,
+		FSRSParams:         []float64{},
+	}
+}
+
+// NewDeckOptions creates an option group with Anki's default settings. If id
+// is 0, a stable ID is derived from the name.
+func NewDeckOptions(id int64, name string) *DeckOptions {
+	if id == 0 {
+		id = deriveID("dconf", name)
+	}
+
+	opts := DefaultDeckOptions()
+	opts.ID = id
+	opts.Name = name
+	return opts
+}
+
+// SetOptions assigns an option group to the deck
+func (d *Deck) SetOptions(opts *DeckOptions) *Deck {
+	d.Options = opts
+	d.Modified = time.Now()
+	return d
+}
+
+// optionsID returns the ID of the deck's option group
+func (d *Deck) optionsID() int64 {
+	if d.Options == nil {
+		return defaultDeckOptionsID
+	}
+	return d.Options.ID
+}
+
+// config converts the options to the JSON layout of col.dconf
+func (o *DeckOptions) config() map[string]interface{} {
+	conf := map[string]interface{}{
+		"id":       o.ID,
+		"mod":      time.Now().Unix(),
+		"name":     o.Name,
+		"usn":      -1,
+		"maxTaken": 60,
+		"autoplay": true,
+		"timer":    0,
+		"replayq":  true,
+		"new": map[string]interface{}{
+			"delays":        o.LearningSteps,
+			"ints":          []int{o.GraduatingInterval, o.EasyInterval, 7},
+			"initialFactor": o.InitialEase,
+			"separate":      true,
+			"order":         0,
+			"perDay":        o.NewPerDay,
+			"bury":          o.BuryNew,
+		},
+		"rev": map[string]interface{}{
+			"perDay":     o.ReviewsPerDay,
+			"ivlFct":     1.0,
+			"ease4":      1.3,
+			"fuzz":       0.05,
+			"minSpace":   1,
+			"maxIvl":     o.MaximumInterval,
+			"hardFactor": 1.2,
+			"bury":       o.BuryReviews,
+		},
+		"lapse": map[string]interface{}{
+			"delays":      o.RelearningSteps,
+			"mult":        0.0,
+			"minInt":      1,
+			"leechFails":  o.LeechThreshold,
+			"leechAction": int(o.LeechAction),
+		},
+		"dyn":                     false,
+		"newMix":                  0,
+		"newPerDayMinimum":        0,
+		"interdayLearningMix":     0,
+		"reviewOrder":             0,
+		"newSortOrder":            0,
+		"newGatherPriority":       0,
+		"buryInterdayLearning":    o.BuryInterdayLearning,
+		"fsrsWeights":             []float64{},
+		"fsrsParams5":             []float64{},
+		"fsrsParams6":             []float64{},
+		"desiredRetention":        o.DesiredRetention,
+		"ignoreRevlogsBeforeDate": "",
+		"easyDaysPercentages":     []float64{1.0, 1.0, 1.0, 1.0, 1.0, 1.0, 1.0},
+		"stopTimerOnAnswer":       false,
+		"secondsToShowQuestion":   0.0,
+		"secondsToShowAnswer":     0.0,
+		"questionAction":          0,
+		"answerAction":            0,
+		"waitForAudio":            true,
+		"sm2Retention":            0.9,
+		"weightSearch":            "",
+	}
+
+	// Anki keeps the parameters of each FSRS version under its own key
+	switch len(o.FSRSParams) {
+	case 17:
+		conf["fsrsWeights"] = o.FSRSParams
+	case 19:
+		conf["fsrsParams5"] = o.FSRSParams
+	case 21:
+		conf["fsrsParams6"] = o.FSRSParams
+	}
+
+	return conf
+}
+
+// validate checks that the options can be written to a collection
+func (o *DeckOptions) validate() error {
+	switch len(o.FSRSParams) {
+	case 0, 17, 19, 21:
+	default:
+		return fmt.Errorf("deck options %q have %d FSRS parameters, expected 17, 19 or 21", o.Name, len(o.FSRSParams))
+	}
+	if o.DesiredRetention <= 0 || o.DesiredRetention >= 1 {
+		return fmt.Errorf("deck options %q have desired retention %v, expected a value between 0 and 1", o.Name, o.DesiredRetention)
+	}
+	return nil
+}
+
+// AddDeckOptions adds an option group to the collection. It may replace
+// Anki's built-in Default group, but adding a group whose ID is taken by one
+// with other settings returns a *DuplicateDeckOptionsIDError.
+func (d *Database) AddDeckOptions(opts *DeckOptions) (*Database, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var dconfJSON string
+	if err := d.db.QueryRow("SELECT dconf FROM col WHERE id = 1").Scan(&dconfJSON); err != nil {
+		return nil, fmt.Errorf("failed to read deck options: %v", err)
+	}
+
+	var dconf map[string]interface{}
+	if err := json.Unmarshal([]byte(dconfJSON), &dconf); err != nil {
+		dconf = make(map[string]interface{})
+	}
+
+	key := fmt.Sprintf("%d", opts.ID)
+	conf := opts.config()
+	if existing, ok := dconf[key]; ok && opts.ID != defaultDeckOptionsID && !sameDeckOptions(existing, conf) {
+		name, _ := existing.(map[string]interface{})["name"].(string)
+		return nil, &DuplicateDeckOptionsIDError{OptionsID: opts.ID, Names: []string{name, opts.Name}}
+	}
+	dconf[key] = conf
+
+	newDconfJSON, err := json.Marshal(dconf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal deck options: %v", err)
+	}
+
+	if _, err := d.db.Exec("UPDATE col SET dconf = ? WHERE id = 1", string(newDconfJSON)); err != nil {
+		return nil, fmt.Errorf("failed to update deck options: %v", err)
+	}
+	return d, nil
+}
+
+// sameDeckOptions reports whether a group stored in col.dconf has the
+// settings of conf, ignoring when either was modified
+func sameDeckOptions(stored interface{}, conf map[string]interface{}) bool {
+	storedConf, ok := stored.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return false
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return false
+	}
+
+	settings := make(map[string]interface{}, len(storedConf))
+	for key, value := range storedConf {
+		settings[key] = value
+	}
+	for _, key := range []string{"mod", "usn"} {
+		delete(settings, key)
+		delete(normalized, key)
+	}
+	return reflect.DeepEqual(settings, normalized)
+}
+
+// AddDeckOptions registers an option group to be written with the package.
+// Option groups assigned to the package's decks are registered automatically.
+func (p *Package) AddDeckOptions(opts *DeckOptions) *Package {
+	p.deckOptions = append(p.deckOptions, opts)
+	return p
+}
+
+// allDeckOptions returns the registered option groups followed by those
+// assigned to decks, without duplicates
+func (p *Package) allDeckOptions(decks []*Deck) []*DeckOptions {
+	seen := make(map[int64]bool)
+	all := make([]*DeckOptions, 0, len(p.deckOptions))
+
+	add := func(opts *DeckOptions) {
+		if opts == nil || seen[opts.ID] {
+			return
+		}
+		seen[opts.ID] = true
+		all = append(all, opts)
+	}
+
+	for _, opts := range p.deckOptions {
+		add(opts)
+	}
+	for _, deck := range decks {
+		add(deck.Options)
+	}
+	return all
+}
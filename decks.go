@@ -0,0 +1,88 @@
+package genanki
+
+import (
+	"fmt"
+	"strings"
+)
+
+// deckNameSeparator separates the components of a nested deck name
+const deckNameSeparator = "::"
+
+// InvalidDeckNameError reports a deck name with an empty component, such as
+// "Languages::::Verbs" or "Languages::"
+type InvalidDeckNameError struct {
+	DeckID int64
+	Name   string
+}
+
+func (e *InvalidDeckNameError) Error() string {
+	return fmt.Sprintf("deck %d has invalid name %q", e.DeckID, e.Name)
+}
+
+// NormalizeDeckName trims whitespace around each "::" separated component of
+// name and rejects names with empty components
+func NormalizeDeckName(name string) (string, error) {
+	parts := strings.Split(name, deckNameSeparator)
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+		if parts[i] == "" {
+			return "", fmt.Errorf("deck name %q has an empty component", name)
+		}
+	}
+	return strings.Join(parts, deckNameSeparator), nil
+}
+
+// NewSubdeck creates a deck nested under d and returns it. The child's name is
+// d's name followed by "::" and name, and it shares d's option group. If id is
+// 0, a stable ID is derived from the full deck name in d's ID namespace.
+func (d *Deck) NewSubdeck(id int64, name string, desc string) *Deck {
+	fullName := d.Name + deckNameSeparator + name
+	if id == 0 {
+		id = d.idNamespace.DeckID(fullName)
+	}
+
+	child := NewDeck(id, fullName, desc)
+	child.Options = d.Options
+	child.idNamespace = d.idNamespace
+	d.Subdecks = append(d.Subdecks, child)
+	return child
+}
+
+// flattenDecks returns decks and all of their subdecks, parents first
+func flattenDecks(decks []*Deck) []*Deck {
+	all := make([]*Deck, 0, len(decks))
+	for _, deck := range decks {
+		all = append(all, deck)
+		all = append(all, flattenDecks(deck.Subdecks)...)
+	}
+	return all
+}
+
+// missingAncestorDecks returns empty decks for every ancestor of decks that is
+// not itself part of decks, so nested decks import with their full hierarchy
+func missingAncestorDecks(decks []*Deck) ([]*Deck, error) {
+	existing := make(map[string]bool, len(decks))
+	for _, deck := range decks {
+		name, err := NormalizeDeckName(deck.Name)
+		if err != nil {
+			return nil, err
+		}
+		existing[name] = true
+	}
+
+	missing := make([]*Deck, 0)
+	for _, deck := range decks {
+		name, _ := NormalizeDeckName(deck.Name)
+		parts := strings.Split(name, deckNameSeparator)
+		for i := 1; i < len(parts); i++ {
+			ancestor := strings.Join(parts[:i], deckNameSeparator)
+			if existing[ancestor] {
+				continue
+			}
+			existing[ancestor] = true
+			missing = append(missing, deck.idNamespace.NewDeck(ancestor, ""))
+		}
+	}
+
+	return missing, nil
+}
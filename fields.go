@@ -0,0 +1,149 @@
+package genanki
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// NewNoteFromMap creates a note for model from field values keyed by field
+// name, so notes keep working when the model's fields are reordered. Fields
+// missing from values are left empty; unknown names are an error, as is
+// leaving out the first field or every field the model's templates need.
+func NewNoteFromMap(model *Model, values map[string]string, tags []string) (*Note, error) {
+	if len(model.Fields) == 0 {
+		return nil, fmt.Errorf("model %q has no fields", model.Name)
+	}
+
+	fields := make([]string, len(model.Fields))
+	for name, value := range values {
+		idx := model.fieldIndex(name)
+		if idx < 0 {
+			return nil, fmt.Errorf("model %q has no field named %q", model.Name, name)
+		}
+		fields[idx] = value
+	}
+
+	if emptyFieldRegexp.MatchString(fields[0]) {
+		return nil, fmt.Errorf("missing required field %q", model.Fields[0].Name)
+	}
+
+	note := NewNote(model.ID, fields, tags)
+	note.updateSortField(model)
+	if _, err := cardOrdinals(model, note); err != nil {
+		return nil, fmt.Errorf("missing required fields: %v", err)
+	}
+
+	return note, nil
+}
+
+// NoteBuilder builds a note field by field using field names
+type NoteBuilder struct {
+	model  *Model
+	values map[string]string
+	tags   []string
+}
+
+// NewNoteBuilder starts building a note for model
+func NewNoteBuilder(model *Model) *NoteBuilder {
+	return &NoteBuilder{
+		model:  model,
+		values: make(map[string]string),
+		tags:   make([]string, 0),
+	}
+}
+
+// Set sets the field with the given name
+func (b *NoteBuilder) Set(name, value string) *NoteBuilder {
+	b.values[name] = value
+	return b
+}
+
+// Tags adds tags to the note
+func (b *NoteBuilder) Tags(tags ...string) *NoteBuilder {
+	b.tags = append(b.tags, tags...)
+	return b
+}
+
+// Build creates the note, with the same checks as NewNoteFromMap
+func (b *NoteBuilder) Build() (*Note, error) {
+	return NewNoteFromMap(b.model, b.values, b.tags)
+}
+
+// Get returns the value of the field with the given name, looked up in the
+// note's model
+func (n *Note) Get(model *Model, name string) (string, error) {
+	idx, err := n.namedFieldIndex(model, name)
+	if err != nil {
+		return "", err
+	}
+	if idx >= len(n.Fields) {
+		return "", nil
+	}
+	return n.Fields[idx], nil
+}
+
+// Set updates the field with the given name, looked up in the note's model
+func (n *Note) Set(model *Model, name, value string) error {
+	idx, err := n.namedFieldIndex(model, name)
+	if err != nil {
+		return err
+	}
+
+	for len(n.Fields) < len(model.Fields) {
+		n.Fields = append(n.Fields, "")
+	}
+	n.Fields[idx] = value
+	n.Modified = time.Now()
+	n.updateSortField(model)
+
+	return nil
+}
+
+// updateSortField recomputes the note's sort field from the model's sort
+// field, and its checksum from the first field
+func (n *Note) updateSortField(model *Model) {
+	if model.SortFieldIndex >= 0 && model.SortFieldIndex < len(n.Fields) {
+		n.SortField = sortFieldText(n.Fields[model.SortFieldIndex])
+	}
+	n.CheckSum = fieldChecksum(n.Fields[0])
+}
+
+func (n *Note) namedFieldIndex(model *Model, name string) (int, error) {
+	if model.ID != n.ModelID {
+		return 0, fmt.Errorf("note %d belongs to model %d, not %d", n.ID, n.ModelID, model.ID)
+	}
+	idx := model.fieldIndex(name)
+	if idx < 0 {
+		return 0, fmt.Errorf("model %q has no field named %q", model.Name, name)
+	}
+	return idx, nil
+}
+
+// fieldChecksum returns Anki's checksum of a field: the first 8 hex digits of
+// the SHA1 of its text with HTML stripped
+func fieldChecksum(field string) int64 {
+	hash := sha1.Sum([]byte(stripHTMLPreservingMediaFilenames(field)))
+	return int64(binary.BigEndian.Uint32(hash[:4]))
+}
+
+// sortFieldText returns the value Anki stores in the sfld column for field
+func sortFieldText(field string) string {
+	return stripHTMLPreservingMediaFilenames(field)
+}
+
+// sortFieldValue converts a sort field to the value stored in sfld. Anki
+// declares the column as integer so that purely numeric sort fields sort
+// numerically in the browser; we store them as numbers explicitly.
+func sortFieldValue(text string) interface{} {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return text
+}
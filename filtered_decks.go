@@ -0,0 +1,139 @@
+package genanki
+
+import (
+	"fmt"
+	"time"
+)
+
+// FilteredDeckOrder is the order in which a filtered deck gathers cards
+type FilteredDeckOrder int
+
+const (
+	FilteredOldestSeenFirst     FilteredDeckOrder = 0
+	FilteredRandom              FilteredDeckOrder = 1
+	FilteredIntervalAscending   FilteredDeckOrder = 2
+	FilteredIntervalDescending  FilteredDeckOrder = 3
+	FilteredMostLapses          FilteredDeckOrder = 4
+	FilteredOrderAdded          FilteredDeckOrder = 5
+	FilteredOrderDue            FilteredDeckOrder = 6
+	FilteredLatestAddedFirst    FilteredDeckOrder = 7
+	FilteredRelativeOverdueness FilteredDeckOrder = 8
+)
+
+// maxFilterTerms is the number of search terms Anki supports per filtered deck
+const maxFilterTerms = 2
+
+// FilterTerm is one search of a filtered deck
+type FilterTerm struct {
+	Search string
+	Limit  int
+	Order  FilteredDeckOrder
+}
+
+// FilteredDeck is an Anki filtered (dynamic) deck, which Anki fills with the
+// cards matching its search terms when the deck is built
+type FilteredDeck struct {
+	ID   int64
+	Name string
+	Desc string
+	// Terms holds one or two searches; the second one is Anki's optional
+	// "second filter"
+	Terms []FilterTerm
+	// Reschedule controls whether reviews in the deck affect scheduling
+	Reschedule bool
+}
+
+// NewFilteredDeck creates a filtered deck with a single search term. Cards are
+// rescheduled based on answers, as in Anki's default. If id is 0, a stable ID
+// is derived from the name.
+func NewFilteredDeck(id int64, name string, search string, limit int, order FilteredDeckOrder) *FilteredDeck {
+	if id == 0 {
+		id = IDNamespace("").DeckID(name)
+	}
+
+	return &FilteredDeck{
+		ID:         id,
+		Name:       name,
+		Terms:      []FilterTerm{{Search: search, Limit: limit, Order: order}},
+		Reschedule: true,
+	}
+}
+
+// AddTerm adds a second search term
+func (f *FilteredDeck) AddTerm(search string, limit int, order FilteredDeckOrder) *FilteredDeck {
+	f.Terms = append(f.Terms, FilterTerm{Search: search, Limit: limit, Order: order})
+	return f
+}
+
+// SetReschedule sets whether answers in the deck reschedule cards
+func (f *FilteredDeck) SetReschedule(reschedule bool) *FilteredDeck {
+	f.Reschedule = reschedule
+	return f
+}
+
+func (f *FilteredDeck) validate() error {
+	if len(f.Terms) == 0 || len(f.Terms) > maxFilterTerms {
+		return fmt.Errorf("filtered deck %q has %d search terms, expected 1 or %d", f.Name, len(f.Terms), maxFilterTerms)
+	}
+	for _, term := range f.Terms {
+		if term.Limit <= 0 {
+			return fmt.Errorf("filtered deck %q has search %q with limit %d", f.Name, term.Search, term.Limit)
+		}
+		if term.Order < FilteredOldestSeenFirst || term.Order > FilteredRelativeOverdueness {
+			return fmt.Errorf("filtered deck %q has search %q with unknown order %d", f.Name, term.Search, term.Order)
+		}
+	}
+	return nil
+}
+
+// AddFilteredDeck adds a filtered deck to the collection
+func (d *Database) AddFilteredDeck(deck *FilteredDeck) (*Database, error) {
+	name, err := NormalizeDeckName(deck.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := deck.validate(); err != nil {
+		return nil, err
+	}
+
+	terms := make([]interface{}, len(deck.Terms))
+	for i, term := range deck.Terms {
+		terms[i] = []interface{}{term.Search, term.Limit, int(term.Order)}
+	}
+
+	deckConfig := map[string]interface{}{
+		"id":               deck.ID,
+		"mod":              time.Now().Unix(),
+		"name":             name,
+		"usn":              -1,
+		"lrnToday":         []int{0, 0},
+		"revToday":         []int{0, 0},
+		"newToday":         []int{0, 0},
+		"timeToday":        []int{0, 0},
+		"collapsed":        false,
+		"browserCollapsed": false,
+		"desc":             deck.Desc,
+		"dyn":              1,
+		"resched":          deck.Reschedule,
+		"terms":            terms,
+		"separate":         true,
+		"delays":           nil,
+		"previewDelay":     0,
+		"previewAgainSecs": 60,
+		"previewHardSecs":  600,
+		"previewGoodSecs":  0,
+	}
+
+	if err := d.putDeck(deck.ID, deckConfig); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// AddFilteredDeck adds a filtered deck to the package, written as a dyn=1
+// deck entry with its search terms. Importing an .apkg drops filtered decks,
+// so WriteToFile only writes them to a .colpkg path.
+func (p *Package) AddFilteredDeck(deck *FilteredDeck) *Package {
+	p.filteredDecks = append(p.filteredDecks, deck)
+	return p
+}
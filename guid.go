@@ -0,0 +1,29 @@
+package genanki
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+)
+
+// base91Table is the alphabet Anki uses to encode note GUIDs
+const base91Table = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_`{|}~"
+
+// GuidFor derives a stable note GUID from values, producing the same result as
+// python genanki's guid_for so decks built with either library update the same
+// notes on import.
+func GuidFor(values ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(values, "__")))
+	n := binary.BigEndian.Uint64(hash[:8])
+
+	encoded := make([]byte, 0, 11)
+	for n > 0 {
+		encoded = append(encoded, base91Table[n%uint64(len(base91Table))])
+		n /= uint64(len(base91Table))
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
@@ -0,0 +1,29 @@
+package genanki
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// htmlRegexp matches comments, style and script blocks and any other tag
+var htmlRegexp = regexp.MustCompile(`(?si)(<!--.*?-->)|(<style.*?>.*?</style>)|(<script.*?>.*?</script>)|(<.*?>)`)
+
+// htmlMediaRegexp matches media tags and captures the referenced filename
+var htmlMediaRegexp = regexp.MustCompile(`(?si)<\b(?:img|audio|video|object)\b(?:[^>"']|"[^"]*"|'[^']*')*?\b(?:src|data)\b=(?:"([^"]+?)"|'([^']+?)'|([^\s>]+))[^>]*>`)
+
+// stripHTML removes tags and decodes entities the same way Anki's strip_html does
+func stripHTML(s string) string {
+	s = htmlRegexp.ReplaceAllString(s, "")
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	return strings.ReplaceAll(html.UnescapeString(s), "\u00a0", " ")
+}
+
+// stripHTMLPreservingMediaFilenames strips HTML like stripHTML but keeps the
+// filenames of images, audio and video, matching Anki's
+// strip_html_preserving_media_filenames
+func stripHTMLPreservingMediaFilenames(s string) string {
+	return stripHTML(htmlMediaRegexp.ReplaceAllString(s, " ${1}${2}${3} "))
+}
@@ -0,0 +1,197 @@
+package genanki
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// IDNamespace derives stable deck and model IDs from names. Using the same
+// namespace and names on every build keeps IDs consistent, so re-importing a
+// rebuilt package updates the existing decks and note types, while different
+// names no longer share Anki's standard IDs and overwrite each other.
+//
+//	ns := genanki.IDNamespace("spanish-course")
+//	deck := ns.NewDeck("Spanish::Verbs", "")
+//	model := ns.NewBasicModel("Spanish Basic")
+type IDNamespace string
+
+// DeckID returns the stable ID of the deck with the given name
+func (ns IDNamespace) DeckID(name string) int64 {
+	return deriveID("deck", string(ns), name)
+}
+
+// ModelID returns the stable ID of the model with the given name
+func (ns IDNamespace) ModelID(name string) int64 {
+	return deriveID("model", string(ns), name)
+}
+
+// NewDeck creates a deck whose ID is derived from its name. Subdecks created
+// from it with NewSubdeck derive their IDs from the same namespace.
+func (ns IDNamespace) NewDeck(name string, desc string) *Deck {
+	deck := NewDeck(ns.DeckID(name), name, desc)
+	deck.idNamespace = ns
+	return deck
+}
+
+// NewModel creates an empty model whose ID is derived from its name
+func (ns IDNamespace) NewModel(name string) *Model {
+	return NewModel(ns.ModelID(name), name)
+}
+
+// NewBasicModel creates a basic model whose ID is derived from its name
+func (ns IDNamespace) NewBasicModel(name string) *BasicModel {
+	return NewBasicModel(ns.ModelID(name), name)
+}
+
+// NewClozeModel creates a cloze model whose ID is derived from its name
+func (ns IDNamespace) NewClozeModel(name string) *ClozeModel {
+	return NewClozeModel(ns.ModelID(name), name)
+}
+
+// DuplicateModelIDError reports models that share an ID but differ in content,
+// which would make one overwrite the other in the collection
+type DuplicateModelIDError struct {
+	ModelID int64
+	Names   []string
+}
+
+func (e *DuplicateModelIDError) Error() string {
+	return fmt.Sprintf("models %s share ID %d but differ", quoteNames(e.Names), e.ModelID)
+}
+
+// DuplicateDeckIDError reports decks that share an ID but differ in content
+type DuplicateDeckIDError struct {
+	DeckID int64
+	Names  []string
+}
+
+func (e *DuplicateDeckIDError) Error() string {
+	return fmt.Sprintf("decks %s share ID %d but differ", quoteNames(e.Names), e.DeckID)
+}
+
+// DuplicateDeckOptionsIDError reports option groups that share an ID but
+// differ in their settings
+type DuplicateDeckOptionsIDError struct {
+	OptionsID int64
+	Names     []string
+}
+
+func (e *DuplicateDeckOptionsIDError) Error() string {
+	return fmt.Sprintf("deck options %s share ID %d but differ", quoteNames(e.Names), e.OptionsID)
+}
+
+// DuplicateNoteIDError reports different notes that share an ID, which the
+// collection cannot hold
+type DuplicateNoteIDError struct {
+	NoteID int64
+	GUIDs  []string
+}
+
+func (e *DuplicateNoteIDError) Error() string {
+	return fmt.Sprintf("notes with GUIDs %s share ID %d", quoteNames(e.GUIDs), e.NoteID)
+}
+
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// duplicateIDs reports items that share an ID but are not the same, with one
+// problem per ID naming its items in order
+func duplicateIDs[T any](items []T, id func(T) int64, name func(T) string, same func(a, b T) bool, problem func(id int64, names []string) error) []error {
+	first := make(map[int64]T)
+	names := make(map[int64][]string)
+	order := make([]int64, 0)
+
+	for _, item := range items {
+		itemID := id(item)
+		existing, ok := first[itemID]
+		if !ok {
+			first[itemID] = item
+			continue
+		}
+		if same(existing, item) {
+			continue
+		}
+		if names[itemID] == nil {
+			names[itemID] = []string{name(existing)}
+			order = append(order, itemID)
+		}
+		names[itemID] = append(names[itemID], name(item))
+	}
+
+	problems := make([]error, len(order))
+	for i, itemID := range order {
+		problems[i] = problem(itemID, names[itemID])
+	}
+	return problems
+}
+
+// duplicateModelIDs reports models that share an ID with different content.
+// Adding the same model twice, or an identical copy, is not a collision.
+func duplicateModelIDs(models []*Model) []error {
+	return duplicateIDs(models,
+		func(model *Model) int64 { return model.ID },
+		func(model *Model) string { return model.Name },
+		func(a, b *Model) bool { return a == b || reflect.DeepEqual(*a, *b) },
+		func(id int64, names []string) error { return &DuplicateModelIDError{ModelID: id, Names: names} },
+	)
+}
+
+// duplicateDeckOptionsIDs reports option groups that share an ID with
+// different settings. Decks sharing one group is not a collision.
+func duplicateDeckOptionsIDs(options []*DeckOptions) []error {
+	return duplicateIDs(options,
+		func(opts *DeckOptions) int64 { return opts.ID },
+		func(opts *DeckOptions) string { return opts.Name },
+		func(a, b *DeckOptions) bool { return a == b || reflect.DeepEqual(*a, *b) },
+		func(id int64, names []string) error { return &DuplicateDeckOptionsIDError{OptionsID: id, Names: names} },
+	)
+}
+
+// duplicateDeckIDs reports regular and filtered decks that share an ID with
+// a different name, description or option group
+func duplicateDeckIDs(decks []*Deck, filtered []*FilteredDeck) []error {
+	type deckIdentity struct {
+		id      int64
+		name    string
+		desc    string
+		options int64
+		dyn     bool
+	}
+
+	identities := make([]deckIdentity, 0, len(decks)+len(filtered))
+	for _, deck := range decks {
+		identities = append(identities, deckIdentity{id: deck.ID, name: deck.Name, desc: deck.Desc, options: deck.optionsID()})
+	}
+	for _, deck := range filtered {
+		identities = append(identities, deckIdentity{id: deck.ID, name: deck.Name, desc: deck.Desc, dyn: true})
+	}
+
+	return duplicateIDs(identities,
+		func(deck deckIdentity) int64 { return deck.id },
+		func(deck deckIdentity) string { return deck.name },
+		func(a, b deckIdentity) bool { return a == b },
+		func(id int64, names []string) error { return &DuplicateDeckIDError{DeckID: id, Names: names} },
+	)
+}
+
+// duplicateNoteIDs reports notes that share an ID. A note added to two decks
+// is reported too, as it would be written twice.
+func duplicateNoteIDs(notes []*Note) []error {
+	return duplicateIDs(notes,
+		func(note *Note) int64 { return note.ID },
+		func(note *Note) string {
+			if note.GUID != "" {
+				return note.GUID
+			}
+			return GuidFor(note.Fields...)
+		},
+		func(a, b *Note) bool { return false },
+		func(id int64, guids []string) error { return &DuplicateNoteIDError{NoteID: id, GUIDs: guids} },
+	)
+}
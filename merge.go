@@ -0,0 +1,334 @@
+package genanki
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GUIDConflictPolicy decides what MergePackages does with notes of different
+// packages that share a GUID, which Anki would treat as the same note
+type GUIDConflictPolicy int
+
+const (
+	// GUIDConflictKeepFirst keeps the note of the earliest package
+	GUIDConflictKeepFirst GUIDConflictPolicy = iota
+	// GUIDConflictKeepNewest keeps the most recently modified note, in its
+	// own deck; ties go to the earliest package
+	GUIDConflictKeepNewest
+	// GUIDConflictFail makes the merge fail
+	GUIDConflictFail
+)
+
+// mediaReference matches the media references Anki finds in note fields:
+// src attributes and [sound:...] tags
+var mediaReference = regexp.MustCompile(`(?i)(\bsrc\s*=\s*)(?:"([^"]*)"|'([^']*)'|([^\s>"']+))|\[sound:([^\]]+)\]`)
+
+// MergePackages combines copies of packages into a new one, leaving them
+// unchanged. Models, decks, option groups and filtered decks with the same ID
+// are kept once, from the earliest package; decks with the same ID share
+// their notes and subdecks. Notes with the same GUID are resolved by policy,
+// and notes with different GUIDs that share an ID get a new ID.
+// Media files whose name is taken by different content, in another package
+// or in another deck of the same package, are renamed, and the references in
+// the notes using them are rewritten.
+func MergePackages(policy GUIDConflictPolicy, packages ...*Package) (*Package, error) {
+	merged := NewPackage([]*Deck{})
+	if len(packages) > 0 {
+		merged.newCardOrder = packages[0].newCardOrder
+		merged.format = packages[0].format
+	}
+
+	models := make(map[int64]*Model)
+	options := make(map[int64]*DeckOptions)
+	filtered := make(map[int64]bool)
+	decks := make(map[int64]*Deck)
+	notes := make(map[string]*Note)
+	noteDecks := make(map[*Note]*Deck)
+	noteIDs := make(map[int64]bool)
+
+	for i, pkg := range packages {
+		if pkg.db != nil {
+			return nil, fmt.Errorf("package %d is backed by a database and cannot be merged", i+1)
+		}
+
+		for _, model := range pkg.models {
+			existing, ok := models[model.ID]
+			if !ok {
+				models[model.ID] = cloneModel(model)
+				merged.AddModel(models[model.ID])
+				continue
+			}
+			if len(existing.Fields) != len(model.Fields) {
+				return nil, fmt.Errorf("model %d has %d fields in one package and %d in another", model.ID, len(existing.Fields), len(model.Fields))
+			}
+		}
+		// Option groups are copied once and shared by the merged decks using them
+		optionsFor := func(opts *DeckOptions) *DeckOptions {
+			if opts == nil {
+				return nil
+			}
+			if options[opts.ID] == nil {
+				options[opts.ID] = cloneDeckOptions(opts)
+			}
+			return options[opts.ID]
+		}
+		for _, opts := range pkg.deckOptions {
+			if options[opts.ID] == nil {
+				merged.AddDeckOptions(optionsFor(opts))
+			}
+		}
+		for _, deck := range pkg.filteredDecks {
+			if !filtered[deck.ID] {
+				filtered[deck.ID] = true
+				copied := *deck
+				copied.Terms = slices.Clone(deck.Terms)
+				merged.AddFilteredDeck(&copied)
+			}
+		}
+
+		packageRenames := merged.mergeMedia(pkg.media)
+
+		var mergeDeck func(deck *Deck, parent *Deck) error
+		mergeDeck = func(deck *Deck, parent *Deck) error {
+			// A deck's own media wins over the package's for its notes, as
+			// when the package is written
+			renames := packageRenames
+			if deckRenames := merged.mergeMedia(deck.Media); len(deckRenames) > 0 {
+				renames = make(map[string]string, len(packageRenames)+len(deckRenames))
+				for filename, renamed := range packageRenames {
+					renames[filename] = renamed
+				}
+				for filename, renamed := range deckRenames {
+					renames[filename] = renamed
+				}
+			}
+
+			target := decks[deck.ID]
+			if target == nil {
+				target = &Deck{
+					ID:          deck.ID,
+					Name:        deck.Name,
+					Desc:        deck.Desc,
+					Notes:       make([]*Note, 0, len(deck.Notes)),
+					Options:     optionsFor(deck.Options),
+					Created:     deck.Created,
+					Modified:    deck.Modified,
+					idNamespace: deck.idNamespace,
+				}
+				decks[deck.ID] = target
+				if parent == nil {
+					merged.decks = append(merged.decks, target)
+				} else {
+					parent.Subdecks = append(parent.Subdecks, target)
+				}
+			}
+
+			for _, note := range deck.Notes {
+				note = cloneNote(note)
+				note.Fields = rewriteMediaReferences(note.Fields, renames)
+
+				guid := note.GUID
+				if guid == "" {
+					guid = GuidFor(note.Fields...)
+				}
+				existing, ok := notes[guid]
+				if ok {
+					switch policy {
+					case GUIDConflictFail:
+						return fmt.Errorf("notes %d and %d have the same GUID %q", existing.ID, note.ID, guid)
+					case GUIDConflictKeepNewest:
+						if !note.Modified.After(existing.Modified) {
+							continue
+						}
+						removeNote(noteDecks[existing], existing)
+						delete(noteIDs, existing.ID)
+					default:
+						continue
+					}
+				}
+
+				for noteIDs[note.ID] {
+					note.ID = GenerateIntID()
+				}
+				noteIDs[note.ID] = true
+				notes[guid] = note
+				noteDecks[note] = target
+				target.Notes = append(target.Notes, note)
+			}
+
+			for _, subdeck := range deck.Subdecks {
+				if err := mergeDeck(subdeck, target); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, deck := range pkg.decks {
+			if err := mergeDeck(deck, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// MergePackageFiles reads .apkg files and merges them with MergePackages
+func MergePackageFiles(policy GUIDConflictPolicy, paths ...string) (*Package, error) {
+	packages := make([]*Package, len(paths))
+	for i, path := range paths {
+		pkg, err := OpenPackage(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		packages[i] = pkg
+	}
+	return MergePackages(policy, packages...)
+}
+
+// mergeMedia adds media files to the package, renaming files whose name is
+// taken by different content. It returns the renames.
+func (p *Package) mergeMedia(media map[string][]byte) map[string]string {
+	filenames := make([]string, 0, len(media))
+	for filename := range media {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	renames := make(map[string]string)
+	for _, filename := range filenames {
+		data := media[filename]
+		existing, taken := p.media[filename]
+		if !taken {
+			p.media[filename] = data
+			continue
+		}
+		if string(existing) == string(data) {
+			continue
+		}
+
+		renamed := renamedMediaFile(filename, data, p.media)
+		p.media[renamed] = data
+		renames[filename] = renamed
+	}
+	return renames
+}
+
+// renamedMediaFile returns a name for a media file whose name is taken,
+// inserting part of its content hash before the extension
+func renamedMediaFile(filename string, data []byte, taken map[string][]byte) string {
+	ext := filepath.Ext(filename)
+	stem := strings.TrimSuffix(filename, ext)
+	base := fmt.Sprintf("%s_%s", stem, GenerateMediaHash(data)[:8])
+
+	renamed := base + ext
+	for n := 2; ; n++ {
+		existing, ok := taken[renamed]
+		if !ok || string(existing) == string(data) {
+			return renamed
+		}
+		renamed = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+}
+
+// rewriteMediaReferences returns fields with references to renamed media
+// files pointing at their new names
+func rewriteMediaReferences(fields []string, renames map[string]string) []string {
+	if len(renames) == 0 {
+		return fields
+	}
+
+	rewritten := make([]string, len(fields))
+	for i, field := range fields {
+		rewritten[i] = mediaReference.ReplaceAllStringFunc(field, func(reference string) string {
+			groups := mediaReference.FindStringSubmatch(reference)
+			if groups[5] != "" {
+				if renamed, ok := renameReference(groups[5], renames); ok {
+					return "[sound:" + renamed + "]"
+				}
+				return reference
+			}
+
+			for group, quote := range map[int]string{2: `"`, 3: "'", 4: ""} {
+				if groups[group] == "" {
+					continue
+				}
+				if renamed, ok := renameReference(groups[group], renames); ok {
+					return groups[1] + quote + renamed + quote
+				}
+			}
+			return reference
+		})
+	}
+	return rewritten
+}
+
+// renameReference returns the new name for a referenced file, which may be
+// URL-encoded as Anki writes it in src attributes
+func renameReference(name string, renames map[string]string) (string, bool) {
+	if renamed, ok := renames[name]; ok {
+		return renamed, true
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		if renamed, ok := renames[unescaped]; ok {
+			return url.PathEscape(renamed), true
+		}
+	}
+	return "", false
+}
+
+// cloneNote copies a note so a merge can change it without touching the
+// package it came from
+func cloneNote(note *Note) *Note {
+	clone := *note
+	clone.Fields = slices.Clone(note.Fields)
+	clone.Tags = slices.Clone(note.Tags)
+	if note.Schedules != nil {
+		clone.Schedules = make(map[int]*CardSchedule, len(note.Schedules))
+		for ord, schedule := range note.Schedules {
+			if schedule == nil {
+				continue
+			}
+			copied := *schedule
+			copied.Reviews = slices.Clone(schedule.Reviews)
+			copied.CustomData = maps.Clone(schedule.CustomData)
+			clone.Schedules[ord] = &copied
+		}
+	}
+	clone.CustomData = maps.Clone(note.CustomData)
+	return &clone
+}
+
+// cloneModel copies a model with its fields and templates
+func cloneModel(model *Model) *Model {
+	clone := *model
+	clone.Fields = slices.Clone(model.Fields)
+	clone.Templates = slices.Clone(model.Templates)
+	return &clone
+}
+
+// cloneDeckOptions copies an option group with its steps and parameters
+func cloneDeckOptions(opts *DeckOptions) *DeckOptions {
+	clone := *opts
+	clone.LearningSteps = slices.Clone(opts.LearningSteps)
+	clone.RelearningSteps = slices.Clone(opts.RelearningSteps)
+	clone.FSRSParams = slices.Clone(opts.FSRSParams)
+	return &clone
+}
+
+// removeNote removes a note from a deck's notes
+func removeNote(deck *Deck, note *Note) {
+	for i, candidate := range deck.Notes {
+		if candidate == note {
+			deck.Notes = append(deck.Notes[:i], deck.Notes[i+1:]...)
+			return
+		}
+	}
+}
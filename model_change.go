@@ -0,0 +1,343 @@
+package genanki
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ModelMapping describes how notes move to another model, in the shape Anki's
+// "Change Note Type" uses
+type ModelMapping struct {
+	// Fields gives, for each field of the new model, the index of the old
+	// field whose content it takes, or -1 to leave it empty. If nil, fields
+	// are matched by position.
+	Fields []int
+	// Templates gives, for each template of the new model, the ordinal of the
+	// old template whose cards (and their scheduling) it takes, or -1. Cards
+	// of old templates that are not listed are deleted. If nil, templates are
+	// matched by position. It must be nil when the new model is a cloze
+	// model, whose cards keep their cloze numbers.
+	Templates []int
+}
+
+// resolve validates the mapping between two models, filling in positional
+// defaults. A nil template mapping keeps card ordinals as they are.
+func (m *ModelMapping) resolve(oldModel, newModel *Model) ([]int, []int, error) {
+	if m == nil {
+		m = &ModelMapping{}
+	}
+
+	fields := m.Fields
+	if fields == nil {
+		fields = positionalMapping(len(newModel.Fields), len(oldModel.Fields))
+	}
+	if len(fields) != len(newModel.Fields) {
+		return nil, nil, fmt.Errorf("field mapping has %d entries, model %q has %d fields", len(fields), newModel.Name, len(newModel.Fields))
+	}
+	for i, old := range fields {
+		if old < -1 || old >= len(oldModel.Fields) {
+			return nil, nil, fmt.Errorf("field %q is mapped from field %d, model %q has %d fields", newModel.Fields[i].Name, old, oldModel.Name, len(oldModel.Fields))
+		}
+	}
+
+	if getModelType(newModel) == 1 {
+		if m.Templates != nil {
+			return nil, nil, fmt.Errorf("cloze model %q takes no template mapping", newModel.Name)
+		}
+		return fields, nil, nil
+	}
+
+	templates := m.Templates
+	if templates == nil {
+		templates = positionalMapping(len(newModel.Templates), len(oldModel.Templates))
+		if getModelType(oldModel) == 1 {
+			// Cloze cards have one ordinal per cloze number, not per template
+			templates = positionalMapping(len(newModel.Templates), len(newModel.Templates))
+		}
+	}
+	if len(templates) != len(newModel.Templates) {
+		return nil, nil, fmt.Errorf("template mapping has %d entries, model %q has %d templates", len(templates), newModel.Name, len(newModel.Templates))
+	}
+	used := make(map[int]bool)
+	for i, old := range templates {
+		if old < -1 || (old >= len(oldModel.Templates) && getModelType(oldModel) != 1) {
+			return nil, nil, fmt.Errorf("template %q is mapped from template %d, model %q has %d templates", newModel.Templates[i].Name, old, oldModel.Name, len(oldModel.Templates))
+		}
+		if old >= 0 && used[old] {
+			return nil, nil, fmt.Errorf("template %d is mapped to more than one template", old)
+		}
+		used[old] = true
+	}
+	return fields, templates, nil
+}
+
+// positionalMapping maps each of n new items to the old item at the same
+// position, or -1 past the end of the old ones
+func positionalMapping(n, old int) []int {
+	mapping := make([]int, n)
+	for i := range mapping {
+		mapping[i] = i
+		if i >= old {
+			mapping[i] = -1
+		}
+	}
+	return mapping
+}
+
+// remapFields returns the fields of a note under a resolved field mapping
+func remapFields(fields []string, mapping []int) []string {
+	remapped := make([]string, len(mapping))
+	for i, old := range mapping {
+		if old >= 0 && old < len(fields) {
+			remapped[i] = fields[old]
+		}
+	}
+	return remapped
+}
+
+// remapOrd returns the new ordinal of a card under a resolved template
+// mapping, or false if the card is dropped
+func remapOrd(ord int, mapping []int) (int, bool) {
+	if mapping == nil {
+		return ord, true
+	}
+	for i, old := range mapping {
+		if old == ord {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ChangeModel moves notes of one model to the package's model with the given
+// ID. Fields and card scheduling are carried over as the mapping describes;
+// scheduling of cards whose template is not mapped is dropped.
+func (p *Package) ChangeModel(notes []*Note, modelID int64, mapping *ModelMapping) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	newModel := p.GetModel(modelID)
+	if newModel == nil {
+		return fmt.Errorf("model %d is not in the package", modelID)
+	}
+	oldModel := p.GetModel(notes[0].ModelID)
+	if oldModel == nil {
+		return fmt.Errorf("model %d is not in the package", notes[0].ModelID)
+	}
+	for _, note := range notes {
+		if note.ModelID != oldModel.ID {
+			return fmt.Errorf("notes have different models: %d and %d", oldModel.ID, note.ModelID)
+		}
+	}
+
+	fields, templates, err := mapping.resolve(oldModel, newModel)
+	if err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		note.ModelID = newModel.ID
+		note.Fields = remapFields(note.Fields, fields)
+		note.updateSortField(newModel)
+
+		if note.Schedules == nil {
+			continue
+		}
+		schedules := make(map[int]*CardSchedule, len(note.Schedules))
+		for ord, schedule := range note.Schedules {
+			if newOrd, ok := remapOrd(ord, templates); ok {
+				schedules[newOrd] = schedule
+			}
+		}
+		note.Schedules = schedules
+	}
+	return nil
+}
+
+// ChangeModel moves notes of one model in the collection to the model with
+// the given ID. Fields are rewritten and cards renumbered as the mapping
+// describes, keeping their scheduling; cards whose template is not mapped
+// are deleted, and new cards are added for templates the notes now fill in.
+// Like Anki's "Change Note Type", this requires a full sync.
+func (d *Database) ChangeModel(noteIDs []int64, modelID int64, mapping *ModelMapping) (*Database, error) {
+	if len(noteIDs) == 0 {
+		return d, nil
+	}
+
+	// A note listed twice must only be remapped once
+	seen := make(map[int64]bool, len(noteIDs))
+	unique := make([]int64, 0, len(noteIDs))
+	for _, noteID := range noteIDs {
+		if !seen[noteID] {
+			seen[noteID] = true
+			unique = append(unique, noteID)
+		}
+	}
+	noteIDs = unique
+
+	models, err := d.Models()
+	if err != nil {
+		return nil, err
+	}
+	modelsByID := make(map[int64]*Model, len(models))
+	for _, model := range models {
+		modelsByID[model.ID] = model
+	}
+	newModel := modelsByID[modelID]
+	if newModel == nil {
+		return nil, fmt.Errorf("model %d is not in the collection", modelID)
+	}
+	sortIdx, err := d.sortFieldIndex(modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var oldModel *Model
+	var fields, templates []int
+	for _, noteID := range noteIDs {
+		var mid int64
+		var flds string
+		if err := tx.QueryRow("SELECT mid, flds FROM notes WHERE id = ?", noteID).Scan(&mid, &flds); err != nil {
+			return nil, fmt.Errorf("note %d is not in the collection: %v", noteID, err)
+		}
+
+		if oldModel == nil {
+			oldModel = modelsByID[mid]
+			if oldModel == nil {
+				return nil, fmt.Errorf("note %d has unknown model %d", noteID, mid)
+			}
+			if fields, templates, err = mapping.resolve(oldModel, newModel); err != nil {
+				return nil, err
+			}
+		} else if mid != oldModel.ID {
+			return nil, fmt.Errorf("notes have different models: %d and %d", oldModel.ID, mid)
+		}
+
+		noteFields := remapFields(strings.Split(flds, "\x1f"), fields)
+		_, err = tx.Exec(`
+			UPDATE notes SET mid = ?, mod = ?, usn = -1, flds = ?, sfld = ?, csum = ?
+			WHERE id = ?
+		`,
+			newModel.ID,
+			now.Unix(),
+			strings.Join(noteFields, "\x1f"),
+			sortFieldValue(sortFieldText(noteFields[sortIdx])),
+			fieldChecksum(noteFields[0]),
+			noteID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update note %d: %v", noteID, err)
+		}
+
+		ords, deckID, err := remapCards(tx, noteID, templates, now.Unix())
+		if err != nil {
+			return nil, err
+		}
+
+		// A note that generates no cards keeps the ones it has, as in Anki
+		generated, err := cardOrdinals(newModel, &Note{ID: noteID, ModelID: newModel.ID, Fields: noteFields})
+		if err != nil {
+			continue
+		}
+		for _, ord := range generated {
+			if ords[ord] {
+				continue
+			}
+			if err := addGeneratedCard(tx, noteID, deckID, ord, now.Unix()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Changing a note's model is a schema change, which needs a full sync
+	if _, err := tx.Exec("UPDATE col SET mod = ?, scm = ? WHERE id = 1", now.Unix(), now.UnixMilli()); err != nil {
+		return nil, fmt.Errorf("failed to update collection: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return d, nil
+}
+
+// remapCards renumbers a note's cards under a resolved template mapping,
+// deleting the cards it drops. It returns the ordinals the note keeps cards
+// for, and the deck of its first card, where generated cards go.
+func remapCards(tx *sql.Tx, noteID int64, templates []int, mod int64) (map[int]bool, int64, error) {
+	rows, err := tx.Query("SELECT id, ord, did, odid FROM cards WHERE nid = ? ORDER BY ord", noteID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read cards: %v", err)
+	}
+	ords := make(map[int64]int)
+	deckID := int64(defaultDeckID)
+	for first := true; rows.Next(); first = false {
+		var id, did, odid int64
+		var ord int
+		if err := rows.Scan(&id, &ord, &did, &odid); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("failed to read card: %v", err)
+		}
+		ords[id] = ord
+
+		// Cards in a filtered deck belong to their original deck
+		if first {
+			deckID = did
+			if odid != 0 {
+				deckID = odid
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read cards: %v", err)
+	}
+
+	kept := make(map[int]bool, len(ords))
+	for id, ord := range ords {
+		newOrd, ok := remapOrd(ord, templates)
+		if !ok {
+			if _, err := tx.Exec("DELETE FROM cards WHERE id = ?", id); err != nil {
+				return nil, 0, fmt.Errorf("failed to delete card %d: %v", id, err)
+			}
+			if _, err := tx.Exec("INSERT INTO graves (usn, oid, type) VALUES (-1, ?, ?)", id, graveCard); err != nil {
+				return nil, 0, fmt.Errorf("failed to record deleted card: %v", err)
+			}
+			continue
+		}
+		if _, err := tx.Exec("UPDATE cards SET ord = ?, mod = ?, usn = -1 WHERE id = ?", newOrd, mod, id); err != nil {
+			return nil, 0, fmt.Errorf("failed to update card %d: %v", id, err)
+		}
+		kept[newOrd] = true
+	}
+	return kept, deckID, nil
+}
+
+// addGeneratedCard adds a new card to a note at the collection's next
+// new-card position, as Anki does for cards a note starts to generate
+func addGeneratedCard(tx *sql.Tx, noteID, deckID int64, ord int, mod int64) error {
+	var position int64
+	if err := tx.QueryRow("SELECT COALESCE(json_extract(conf, '$.nextPos'), 1) FROM col WHERE id = 1").Scan(&position); err != nil {
+		return fmt.Errorf("failed to read next card position: %v", err)
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+		VALUES (?, ?, ?, ?, ?, -1, ?, ?, ?, 0, 2500, 0, 0, 0, 0, 0, 0, '{}')
+	`, GenerateIntID(), noteID, deckID, ord, mod, int(CardTypeNew), int(QueueNew), position)
+	if err != nil {
+		return fmt.Errorf("failed to add card %d of note %d: %v", ord, noteID, err)
+	}
+
+	if _, err := tx.Exec("UPDATE col SET conf = json_set(conf, '$.nextPos', ?) WHERE id = 1", position+1); err != nil {
+		return fmt.Errorf("failed to update next card position: %v", err)
+	}
+	return nil
+}
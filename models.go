@@ -2,8 +2,11 @@ package genanki
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"math"
+	"strings"
 	"time"
 )
 
@@ -13,6 +16,8 @@ type Model struct {
 	Fields    []Field
 	Templates []Template
 	CSS       string
+	// SortFieldIndex is the field shown and sorted on in Anki's browser
+	SortFieldIndex int
 }
 
 type Field struct {
@@ -35,14 +40,29 @@ type Template struct {
 	Bafmt string
 }
 
+// Note is a note of a model. SortField and CheckSum mirror the note's sfld and
+// csum columns and are informational only: writing a note always derives them
+// from its fields and its model's sort field. NewNote, which doesn't know the
+// model, fills them from the first field; Set and NewNoteFromMap use the
+// model's sort field.
 type Note struct {
 	ID        int64
+	GUID      string
 	ModelID   int64
 	Fields    []string
 	Tags      []string
 	Modified  time.Time
 	SortField string
 	CheckSum  int64
+	// Schedules holds the initial scheduling state of the note's cards by
+	// template (or cloze) ordinal; cards without one are new
+	Schedules map[int]*CardSchedule
+	// Suspended, Buried, Flag and CustomData apply to every card of the note
+	// that does not set its own in Schedules
+	Suspended  bool
+	Buried     bool
+	Flag       CardFlag
+	CustomData map[string]string
 }
 
 type Deck struct {
@@ -51,8 +71,12 @@ type Deck struct {
 	Desc     string
 	Notes    []*Note
 	Media    map[string][]byte
+	Subdecks []*Deck
+	Options  *DeckOptions // nil uses Anki's default option group
 	Created  time.Time
 	Modified time.Time
+	// idNamespace derives the IDs of subdecks and generated parent decks
+	idNamespace IDNamespace
 }
 
 func GenerateIntID() int64 {
@@ -61,6 +85,14 @@ func GenerateIntID() int64 {
 	return int64(binary.LittleEndian.Uint64(b[:]) & math.MaxInt64)
 }
 
+// deriveID returns a stable ID for the given parts. IDs fall in the range
+// [2^30, 2^31) recommended by python genanki, which keeps them clear of
+// timestamp-based IDs created by Anki itself.
+func deriveID(parts ...string) int64 {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return 1<<30 + int64(binary.BigEndian.Uint32(hash[:4])%(1<<30))
+}
+
 func NewModel(id int64, name string) *Model {
 	return &Model{
 		ID:        id,
@@ -74,22 +106,29 @@ func NewModel(id int64, name string) *Model {
 func NewNote(modelID int64, fields []string, tags []string) *Note {
 	now := time.Now()
 
-	csum := int64(0)
-	if len(fields) > 0 {
-		for _, c := range fields[0] {
-			csum = (csum + int64(c)) % 0xffff
-		}
+	note := &Note{
+		ID:       GenerateIntID(),
+		ModelID:  modelID,
+		Fields:   fields,
+		Tags:     tags,
+		Modified: now,
 	}
 
-	return &Note{
-		ID:        GenerateIntID(),
-		ModelID:   modelID,
-		Fields:    fields,
-		Tags:      tags,
-		Modified:  now,
-		SortField: fields[0],
-		CheckSum:  csum,
+	// The note's model is not known here, so the sort field defaults to the
+	// first field; writing the note uses the model's sort field
+	if len(fields) > 0 {
+		note.SortField = sortFieldText(fields[0])
+		note.CheckSum = fieldChecksum(fields[0])
 	}
+
+	return note
+}
+
+// SetGUID sets an explicit GUID, which Anki uses to match the note with an
+// existing one on import
+func (n *Note) SetGUID(guid string) *Note {
+	n.GUID = guid
+	return n
 }
 
 func NewDeck(id int64, name string, desc string) *Deck {
@@ -106,6 +145,7 @@ func NewDeck(id int64, name string, desc string) *Deck {
 		Desc:     desc,
 		Notes:    make([]*Note, 0),
 		Media:    make(map[string][]byte),
+		Subdecks: make([]*Deck, 0),
 		Created:  now,
 		Modified: now,
 	}
@@ -206,6 +246,26 @@ func (m *Model) AddTemplate(template Template) *Model {
 	return m
 }
 
+// SetSortField makes the field with the given name the model's sort field
+func (m *Model) SetSortField(name string) (*Model, error) {
+	idx := m.fieldIndex(name)
+	if idx < 0 {
+		return nil, fmt.Errorf("model %q has no field named %q", m.Name, name)
+	}
+	m.SortFieldIndex = idx
+	return m, nil
+}
+
+// fieldIndex returns the position of the field with the given name, or -1
+func (m *Model) fieldIndex(name string) int {
+	for i, field := range m.Fields {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
 func (m *Model) SetCSS(css string) *Model {
 	m.CSS = css
 	return m
@@ -0,0 +1,277 @@
+package genanki
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Types of the graves entries that tell Anki's sync which objects were deleted
+const (
+	graveCard = 0
+	graveNote = 1
+)
+
+// UpdateNote replaces the fields and tags of a note already in the
+// collection, and its GUID if the note sets one. The note's modification
+// time is bumped and it is marked for the next sync.
+func (d *Database) UpdateNote(note *Note) (*Database, error) {
+	if len(note.Fields) == 0 {
+		return nil, fmt.Errorf("note %d has no fields", note.ID)
+	}
+
+	sortIdx, err := d.sortFieldIndex(note.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	if sortIdx >= len(note.Fields) {
+		return nil, fmt.Errorf("note %d has no field for sort field index %d", note.ID, sortIdx)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var modelID int64
+	if err := tx.QueryRow("SELECT mid FROM notes WHERE id = ?", note.ID).Scan(&modelID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("note %d is not in the collection", note.ID)
+		}
+		return nil, fmt.Errorf("failed to read note: %v", err)
+	}
+	if note.ModelID != modelID {
+		return nil, fmt.Errorf("note %d has model %d in the collection, not %d", note.ID, modelID, note.ModelID)
+	}
+
+	sortField := sortFieldText(note.Fields[sortIdx])
+	csum := fieldChecksum(note.Fields[0])
+
+	noteDataJSON, err := json.Marshal(map[string]interface{}{"tags": note.Tags})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal note data: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE notes SET guid = CASE WHEN ? = '' THEN guid ELSE ? END,
+			mod = ?, usn = -1, tags = ?, flds = ?, sfld = ?, csum = ?, data = ?
+		WHERE id = ?
+	`,
+		note.GUID,
+		note.GUID,
+		time.Now().Unix(),
+		formatAnkiTags(note.Tags),
+		strings.Join(note.Fields, "\x1f"),
+		sortFieldValue(sortField),
+		csum,
+		string(noteDataJSON),
+		note.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update note: %v", err)
+	}
+
+	if err := touchCollection(tx); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return d, nil
+}
+
+// DeleteNote removes a note and its cards, recording both in graves so a
+// sync deletes them too. The cards' review history is kept, as Anki does.
+func (d *Database) DeleteNote(noteID int64) (*Database, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO graves (usn, oid, type)
+		SELECT -1, id, ? FROM cards WHERE nid = ?
+	`, graveCard, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record deleted cards: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM cards WHERE nid = ?", noteID); err != nil {
+		return nil, fmt.Errorf("failed to delete cards: %v", err)
+	}
+
+	result, err := tx.Exec("DELETE FROM notes WHERE id = ?", noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete note: %v", err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return nil, fmt.Errorf("note %d is not in the collection", noteID)
+	}
+	if _, err := tx.Exec("INSERT INTO graves (usn, oid, type) VALUES (-1, ?, ?)", noteID, graveNote); err != nil {
+		return nil, fmt.Errorf("failed to record deleted note: %v", err)
+	}
+
+	if err := touchCollection(tx); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return d, nil
+}
+
+// MoveCards moves cards to a regular deck. Cards in a filtered deck return
+// to their original due date first, as when Anki empties the filtered deck.
+func (d *Database) MoveCards(cardIDs []int64, deckID int64) (*Database, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	decks, err := readDeckEntries(tx)
+	if err != nil {
+		return nil, err
+	}
+	deck, ok := decks[fmt.Sprintf("%d", deckID)]
+	if !ok {
+		return nil, fmt.Errorf("deck %d is not in the collection", deckID)
+	}
+	if dyn, _ := deck["dyn"].(float64); dyn != 0 {
+		return nil, fmt.Errorf("cards cannot be moved into filtered deck %q", deck["name"])
+	}
+
+	now := time.Now().Unix()
+	for _, cardID := range cardIDs {
+		result, err := tx.Exec(`
+			UPDATE cards SET did = ?, due = CASE WHEN odid != 0 THEN odue ELSE due END,
+				odue = 0, odid = 0, mod = ?, usn = -1
+			WHERE id = ?
+		`, deckID, now, cardID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move card %d: %v", cardID, err)
+		}
+		if moved, _ := result.RowsAffected(); moved == 0 {
+			return nil, fmt.Errorf("card %d is not in the collection", cardID)
+		}
+	}
+
+	if err := touchCollection(tx); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return d, nil
+}
+
+// RenameDeck renames a deck and moves its subdecks along with it, so
+// "Spanish::Verbs" becomes "Languages::Spanish::Verbs" when "Spanish" is
+// renamed to "Languages::Spanish". Missing parents of the new name are created.
+func (d *Database) RenameDeck(deckID int64, name string) (*Database, error) {
+	newName, err := NormalizeDeckName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	decks, err := readDeckEntries(tx)
+	if err != nil {
+		return nil, err
+	}
+	deck, ok := decks[fmt.Sprintf("%d", deckID)]
+	if !ok {
+		return nil, fmt.Errorf("deck %d is not in the collection", deckID)
+	}
+	oldName, _ := deck["name"].(string)
+	oldPrefix := oldName + deckNameSeparator
+	if strings.HasPrefix(strings.ToLower(newName+deckNameSeparator), strings.ToLower(oldPrefix)) && !strings.EqualFold(newName, oldName) {
+		return nil, fmt.Errorf("deck %q cannot be moved under itself", oldName)
+	}
+
+	// Deck names are unique regardless of case, outside the renamed subtree,
+	// and subdecks match their parent regardless of case too
+	names := make(map[string]bool, len(decks))
+	renamed := make(map[string]string)
+	for key, entry := range decks {
+		entryName, _ := entry["name"].(string)
+		switch {
+		case strings.EqualFold(entryName, oldName):
+			renamed[key] = newName
+		case len(entryName) > len(oldPrefix) && strings.EqualFold(entryName[:len(oldPrefix)], oldPrefix):
+			renamed[key] = newName + deckNameSeparator + entryName[len(oldPrefix):]
+		default:
+			names[strings.ToLower(entryName)] = true
+		}
+	}
+	for _, renamedName := range renamed {
+		if names[strings.ToLower(renamedName)] {
+			return nil, fmt.Errorf("a deck named %q already exists", renamedName)
+		}
+	}
+
+	now := time.Now().Unix()
+	for key, renamedName := range renamed {
+		decks[key]["name"] = renamedName
+		decks[key]["mod"] = now
+		decks[key]["usn"] = -1
+		names[strings.ToLower(renamedName)] = true
+	}
+
+	parts := strings.Split(newName, deckNameSeparator)
+	for i := 1; i < len(parts); i++ {
+		parentName := strings.Join(parts[:i], deckNameSeparator)
+		if names[strings.ToLower(parentName)] {
+			continue
+		}
+		parent := IDNamespace("").NewDeck(parentName, "")
+		if _, taken := decks[fmt.Sprintf("%d", parent.ID)]; taken {
+			return nil, fmt.Errorf("deck ID %d derived for %q is already used", parent.ID, parentName)
+		}
+		decks[fmt.Sprintf("%d", parent.ID)] = newDeckConfig(parent, parentName)
+		names[strings.ToLower(parentName)] = true
+	}
+
+	decksJSON, err := json.Marshal(decks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal decks: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE col SET decks = ?, mod = ? WHERE id = 1", string(decksJSON), now); err != nil {
+		return nil, fmt.Errorf("failed to update decks: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return d, nil
+}
+
+// readDeckEntries returns the col.decks entries by ID, keeping the fields
+// this package does not model
+func readDeckEntries(tx *sql.Tx) (map[string]map[string]interface{}, error) {
+	var decksJSON string
+	if err := tx.QueryRow("SELECT decks FROM col WHERE id = 1").Scan(&decksJSON); err != nil {
+		return nil, fmt.Errorf("failed to read decks: %v", err)
+	}
+
+	var decks map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(decksJSON), &decks); err != nil {
+		return nil, fmt.Errorf("failed to parse decks: %v", err)
+	}
+	return decks, nil
+}
+
+// touchCollection bumps the collection's modification time
+func touchCollection(tx *sql.Tx) error {
+	if _, err := tx.Exec("UPDATE col SET mod = ? WHERE id = 1", time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to update collection: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package genanki
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NewCardOrder is the order in which WriteToFile assigns new-card positions
+type NewCardOrder int
+
+const (
+	// NewCardsInInsertionOrder follows the order of decks and notes in the package
+	NewCardsInInsertionOrder NewCardOrder = iota
+	// NewCardsByField orders notes by the value of a field
+	NewCardsByField
+	// NewCardsShuffled shuffles notes with a fixed seed
+	NewCardsShuffled
+)
+
+// newCardOrdering holds the package's new-card order and its parameters
+type newCardOrdering struct {
+	order NewCardOrder
+	field string
+	seed  int64
+}
+
+// OrderNewCardsByInsertion positions new cards in the order their decks and
+// notes were added, which is the default
+func (p *Package) OrderNewCardsByInsertion() *Package {
+	p.newCardOrder = newCardOrdering{order: NewCardsInInsertionOrder}
+	return p
+}
+
+// OrderNewCardsByField positions new cards by the value of the named field,
+// with numbers in numeric order before text. Notes whose model has
+// no such field come last, in insertion order.
+func (p *Package) OrderNewCardsByField(name string) *Package {
+	p.newCardOrder = newCardOrdering{order: NewCardsByField, field: name}
+	return p
+}
+
+// ShuffleNewCards positions new cards in a random order that is the same for
+// every build with the same seed
+func (p *Package) ShuffleNewCards(seed int64) *Package {
+	p.newCardOrder = newCardOrdering{order: NewCardsShuffled, seed: seed}
+	return p
+}
+
+// newCardPositions returns the new-card position of each note, starting at 1.
+// Cards of the same note share their note's position, as in Anki.
+func (p *Package) newCardPositions(decks []*Deck, modelsByID map[int64]*Model) (map[*Note]int64, error) {
+	notes := make([]*Note, 0)
+	for _, deck := range decks {
+		notes = append(notes, deck.Notes...)
+	}
+
+	switch p.newCardOrder.order {
+	case NewCardsInInsertionOrder:
+	case NewCardsByField:
+		if err := sortNotesByField(notes, modelsByID, p.newCardOrder.field); err != nil {
+			return nil, err
+		}
+	case NewCardsShuffled:
+		rng := rand.New(rand.NewSource(p.newCardOrder.seed))
+		rng.Shuffle(len(notes), func(i, j int) {
+			notes[i], notes[j] = notes[j], notes[i]
+		})
+	default:
+		return nil, fmt.Errorf("unknown new card order %d", p.newCardOrder.order)
+	}
+
+	positions := make(map[*Note]int64, len(notes))
+	for _, note := range notes {
+		if _, ok := positions[note]; !ok {
+			positions[note] = int64(len(positions) + 1)
+		}
+	}
+	return positions, nil
+}
+
+func sortNotesByField(notes []*Note, modelsByID map[int64]*Model, name string) error {
+	found := false
+	keys := make(map[*Note]string, len(notes))
+	for _, note := range notes {
+		model, ok := modelsByID[note.ModelID]
+		if !ok {
+			continue
+		}
+		index := model.fieldIndex(name)
+		if index < 0 || index >= len(note.Fields) {
+			continue
+		}
+		found = true
+		keys[note] = strings.TrimSpace(stripHTMLPreservingMediaFilenames(note.Fields[index]))
+	}
+	if !found {
+		return fmt.Errorf("no model has field %q to order new cards by", name)
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		a, aok := keys[notes[i]]
+		b, bok := keys[notes[j]]
+		if !aok || !bok {
+			return aok && !bok
+		}
+		return lessFieldValue(a, b)
+	})
+	return nil
+}
+
+// lessFieldValue orders numbers numerically before any text, and text
+// lexically
+func lessFieldValue(a, b string) bool {
+	x, xok := finiteNumber(a)
+	y, yok := finiteNumber(b)
+	switch {
+	case xok && yok:
+		return x < y
+	case xok || yok:
+		return xok
+	}
+	return a < b
+}
+
+// finiteNumber parses a field value as a number. NaN and infinities are
+// treated as text, as NaN can't be ordered.
+func finiteNumber(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
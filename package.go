@@ -7,18 +7,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Package struct {
-	decks    []*Deck
-	models   []*Model
-	media    map[string][]byte
-	db       *Database
-	newNotes []*Note // Track newly added notes
-	debug    bool
+	decks       []*Deck
+	models      []*Model
+	deckOptions []*DeckOptions
+	// filteredDecks are written after regular decks as dyn=1 entries
+	filteredDecks []*FilteredDeck
+	media         map[string][]byte
+	newCardOrder  newCardOrdering
+	format        PackageFormat
+	db            *Database
+	newNotes      []*Note // Track newly added notes
+	debug         bool
 }
 
 // NewPackage creates a new package from decks or a database
@@ -61,6 +67,31 @@ func (p *Package) AddModel(model *Model) *Package {
 	return p
 }
 
+// GetDecks returns the package's top-level decks
+func (p *Package) GetDecks() []*Deck {
+	return p.decks
+}
+
+// GetModels returns the models added to the package
+func (p *Package) GetModels() []*Model {
+	return p.models
+}
+
+// GetModel returns the package's model with the given ID, or nil
+func (p *Package) GetModel(id int64) *Model {
+	for _, model := range p.models {
+		if model.ID == id {
+			return model
+		}
+	}
+	return nil
+}
+
+// GetFilteredDecks returns the filtered decks added to the package
+func (p *Package) GetFilteredDecks() []*FilteredDeck {
+	return p.filteredDecks
+}
+
 func (p *Package) AddMedia(filename string, data []byte) *Package {
 	p.media[filename] = data
 	return p
@@ -75,8 +106,15 @@ func (p *Package) WriteToFile(path string) error {
 		// Using existing database
 		dbToUse = p.db
 	} else {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if len(p.filteredDecks) > 0 && !strings.EqualFold(filepath.Ext(path), ".colpkg") {
+			return fmt.Errorf("filtered decks can only be written to a .colpkg file, Anki drops them when importing %s", path)
+		}
+
 		// Create a new database for the package
-		dbToUse, err = newDatabase()
+		dbToUse, err = NewDatabase()
 		if err != nil {
 			return fmt.Errorf("failed to create database: %v", err)
 		}
@@ -86,7 +124,10 @@ func (p *Package) WriteToFile(path string) error {
 		dbToUse.SetDebug(p.debug)
 
 		// Add all models
+		modelsByID := make(map[int64]*Model, len(p.models))
 		for _, model := range p.models {
+			modelsByID[model.ID] = model
+
 			var modelErr error
 			dbToUse, modelErr = dbToUse.AddModel(model)
 			if modelErr != nil {
@@ -94,8 +135,41 @@ func (p *Package) WriteToFile(path string) error {
 			}
 		}
 
+		decks := flattenDecks(p.decks)
+
+		// Add deck option groups before the decks that use them
+		for _, opts := range p.allDeckOptions(decks) {
+			var optsErr error
+			dbToUse, optsErr = dbToUse.AddDeckOptions(opts)
+			if optsErr != nil {
+				return fmt.Errorf("failed to add deck options to database: %v", optsErr)
+			}
+		}
+
+		// Add ancestors of nested decks that the package doesn't define itself
+		named := append([]*Deck{}, decks...)
+		for _, filtered := range p.filteredDecks {
+			named = append(named, &Deck{ID: filtered.ID, Name: filtered.Name})
+		}
+		ancestors, ancestorErr := missingAncestorDecks(named)
+		if ancestorErr != nil {
+			return fmt.Errorf("failed to resolve parent decks: %v", ancestorErr)
+		}
+		for _, deck := range ancestors {
+			var deckErr error
+			dbToUse, deckErr = dbToUse.AddDeck(deck)
+			if deckErr != nil {
+				return fmt.Errorf("failed to add deck to database: %v", deckErr)
+			}
+		}
+
+		positions, posErr := p.newCardPositions(decks, modelsByID)
+		if posErr != nil {
+			return fmt.Errorf("failed to order new cards: %v", posErr)
+		}
+
 		// Add all decks
-		for _, deck := range p.decks {
+		for _, deck := range decks {
 			var deckErr error
 			dbToUse, deckErr = dbToUse.AddDeck(deck)
 			if deckErr != nil {
@@ -111,11 +185,27 @@ func (p *Package) WriteToFile(path string) error {
 				}
 				p.newNotes = append(p.newNotes, note)
 
-				// Add a card for each note
-				var cardErr error
-				dbToUse, cardErr = dbToUse.AddCard(note.ID, deck.ID, 0)
-				if cardErr != nil {
-					return fmt.Errorf("failed to add card to database: %v", cardErr)
+				model, ok := modelsByID[note.ModelID]
+				if !ok {
+					return fmt.Errorf("note %d references unknown model %d", note.ID, note.ModelID)
+				}
+				ords, ordErr := cardOrdinals(model, note)
+				if ordErr != nil {
+					return fmt.Errorf("failed to generate cards: %v", ordErr)
+				}
+
+				// Add a card for each template that renders for this note
+				for _, ord := range ords {
+					schedule := note.cardState(ord, positions[note])
+					deckID := deck.ID
+					if schedule.DeckID != 0 {
+						deckID = schedule.DeckID
+					}
+					var cardErr error
+					dbToUse, cardErr = dbToUse.AddScheduledCard(note.ID, deckID, ord, schedule)
+					if cardErr != nil {
+						return fmt.Errorf("failed to add card to database: %v", cardErr)
+					}
 				}
 			}
 
@@ -124,6 +214,15 @@ func (p *Package) WriteToFile(path string) error {
 				p.media[filename] = data
 			}
 		}
+
+		// Add filtered decks once the decks their searches refer to exist
+		for _, filtered := range p.filteredDecks {
+			var deckErr error
+			dbToUse, deckErr = dbToUse.AddFilteredDeck(filtered)
+			if deckErr != nil {
+				return fmt.Errorf("failed to add filtered deck to database: %v", deckErr)
+			}
+		}
 	}
 
 	// Create the output file
@@ -136,6 +235,33 @@ func (p *Package) WriteToFile(path string) error {
 	zw := zip.NewWriter(f)
 	defer zw.Close()
 
+	if p.format == FormatLatest {
+		err = p.writeLatestArchive(zw, dbToUse)
+	} else {
+		err = p.writeLegacyArchive(zw, dbToUse)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Print summary information
+	if !p.debug {
+		if p.db != nil {
+			// Using existing database
+			fmt.Printf("Successfully updated Anki package: %s\n", path)
+		} else {
+			// New package
+			fmt.Printf("Successfully created Anki package: %s\n", path)
+			fmt.Printf("Added %d new notes\n", len(p.newNotes))
+		}
+	}
+
+	return nil
+}
+
+// writeLegacyArchive writes the collection as collection.anki2, with media
+// files listed in a JSON media map
+func (p *Package) writeLegacyArchive(zw *zip.Writer, dbToUse *Database) error {
 	w1, err := zw.Create("collection.anki2")
 	if err != nil {
 		return fmt.Errorf("failed to create collection.anki2: %v", err)
@@ -181,18 +307,6 @@ func (p *Package) WriteToFile(path string) error {
 		return fmt.Errorf("failed to write media: %v", err)
 	}
 
-	// Print summary information
-	if !p.debug {
-		if p.db != nil {
-			// Using existing database
-			fmt.Printf("Successfully updated Anki package: %s\n", path)
-		} else {
-			// New package
-			fmt.Printf("Successfully created Anki package: %s\n", path)
-			fmt.Printf("Added %d new notes\n", len(p.newNotes))
-		}
-	}
-
 	return nil
 }
 
@@ -0,0 +1,150 @@
+package genanki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// PackageFormat is the package layout WriteToFile writes
+type PackageFormat int
+
+const (
+	// FormatLegacy writes a schema 11 collection.anki2, which every Anki
+	// version imports
+	FormatLegacy PackageFormat = iota
+	// FormatLatest writes the layout Anki 2.1.50 and later export: a
+	// zstd-compressed schema 18 collection.anki21b, a protobuf media map and a
+	// "meta" version entry, plus a collection.anki2 that asks older versions
+	// to update
+	FormatLatest
+)
+
+// packageVersionLatest is PackageMetadata.Version for collection.anki21b
+const packageVersionLatest = 3
+
+// legacyPlaceholderText is the note older Anki versions import from a
+// FormatLatest package
+const legacyPlaceholderText = "Please update to the latest Anki version, then import the .colpkg/.apkg file again."
+
+// SetFormat sets the package layout written by WriteToFile
+func (p *Package) SetFormat(format PackageFormat) *Package {
+	p.format = format
+	return p
+}
+
+// writeLatestArchive writes the collection as collection.anki21b with
+// zstd-compressed media files
+func (p *Package) writeLatestArchive(zw *zip.Writer, dbToUse *Database) error {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	meta := newProtoMessage()
+	meta.uint(1, packageVersionLatest)
+	if err := writeStoredFile(zw, "meta", meta.buf); err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp("", "anki-*.anki21b")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := dbToUse.writeSchema18(tmpFile.Name()); err != nil {
+		return fmt.Errorf("failed to write collection.anki21b: %v", err)
+	}
+	collection, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read database: %v", err)
+	}
+	if err := writeStoredFile(zw, "collection.anki21b", encoder.EncodeAll(collection, nil)); err != nil {
+		return err
+	}
+
+	placeholder, err := legacyPlaceholderCollection()
+	if err != nil {
+		return err
+	}
+	if err := writeStoredFile(zw, "collection.anki2", placeholder); err != nil {
+		return err
+	}
+
+	filenames := make([]string, 0, len(p.media))
+	for filename := range p.media {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	entries := newProtoMessage()
+	for i, filename := range filenames {
+		data := p.media[filename]
+		if err := writeStoredFile(zw, fmt.Sprintf("%d", i), encoder.EncodeAll(data, nil)); err != nil {
+			return err
+		}
+
+		checksum := sha1.Sum(data)
+		entry := newProtoMessage()
+		entry.string(1, filename)
+		entry.uint(2, uint64(len(data)))
+		entry.bytes(3, checksum[:])
+		entries.message(1, entry)
+	}
+
+	return writeStoredFile(zw, "media", encoder.EncodeAll(entries.buf, nil))
+}
+
+// writeStoredFile adds an uncompressed file to the archive, as Anki does for
+// data that is already zstd-compressed
+func writeStoredFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// legacyPlaceholderCollection builds the collection.anki2 of a FormatLatest
+// package, holding a single note that asks the user to update Anki
+func legacyPlaceholderCollection() ([]byte, error) {
+	db, err := NewDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	model := NewBasicModel(0, "Basic")
+	note := NewNote(model.ID, []string{legacyPlaceholderText, ""}, nil)
+
+	if _, err := db.AddModel(model.Model); err != nil {
+		return nil, err
+	}
+	if _, err := db.AddDeck(NewDeck(defaultDeckID, "Default", "")); err != nil {
+		return nil, err
+	}
+	if _, err := db.AddNote(note); err != nil {
+		return nil, err
+	}
+	if _, err := db.AddCard(note.ID, defaultDeckID, 0); err != nil {
+		return nil, err
+	}
+
+	dbFile, err := db.GetFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database file: %v", err)
+	}
+	defer os.Remove(dbFile)
+
+	return os.ReadFile(dbFile)
+}
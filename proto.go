@@ -0,0 +1,204 @@
+package genanki
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Protobuf wire types used by Anki's collection and package messages
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoMessage encodes a protobuf message field by field. Only the encodings
+// Anki's messages need are supported, and default values are skipped as the
+// protobuf encoding requires.
+type protoMessage struct {
+	buf []byte
+}
+
+// newProtoMessage returns an empty message, which encodes as an empty but
+// non-nil blob
+func newProtoMessage() *protoMessage {
+	return &protoMessage{buf: make([]byte, 0)}
+}
+
+func (m *protoMessage) tag(field int, wireType int) {
+	m.buf = binary.AppendUvarint(m.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (m *protoMessage) uint(field int, value uint64) {
+	if value == 0 {
+		return
+	}
+	m.tag(field, protoVarint)
+	m.buf = binary.AppendUvarint(m.buf, value)
+}
+
+func (m *protoMessage) int(field int, value int64) {
+	m.uint(field, uint64(value))
+}
+
+func (m *protoMessage) bool(field int, value bool) {
+	if value {
+		m.uint(field, 1)
+	}
+}
+
+func (m *protoMessage) float(field int, value float32) {
+	if value == 0 {
+		return
+	}
+	m.tag(field, protoFixed32)
+	m.buf = binary.LittleEndian.AppendUint32(m.buf, math.Float32bits(value))
+}
+
+func (m *protoMessage) floats(field int, values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	packed := make([]byte, 0, 4*len(values))
+	for _, value := range values {
+		packed = binary.LittleEndian.AppendUint32(packed, math.Float32bits(float32(value)))
+	}
+	m.bytes(field, packed)
+}
+
+func (m *protoMessage) bytes(field int, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	m.tag(field, protoBytes)
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(value)))
+	m.buf = append(m.buf, value...)
+}
+
+func (m *protoMessage) string(field int, value string) {
+	m.bytes(field, []byte(value))
+}
+
+// message writes a nested message, which is kept even when empty
+func (m *protoMessage) message(field int, value *protoMessage) {
+	m.tag(field, protoBytes)
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(value.buf)))
+	m.buf = append(m.buf, value.buf...)
+}
+
+// protoValue is a decoded field value: the varint or fixed value for numeric
+// wire types, or the raw bytes for length-delimited ones
+type protoValue struct {
+	wireType int
+	number   uint64
+	data     []byte
+}
+
+// protoFields holds the values of a decoded message by field number
+type protoFields map[int][]protoValue
+
+func decodeProto(data []byte) (protoFields, error) {
+	fields := make(protoFields)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid protobuf field key")
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), int(key&7)
+
+		value := protoValue{wireType: wireType}
+		switch wireType {
+		case protoVarint:
+			value.number, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", field)
+			}
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			value.number = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			value.number = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			value.data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", wireType, field)
+		}
+		fields[field] = append(fields[field], value)
+	}
+	return fields, nil
+}
+
+// last returns the final value of a field, which wins for non-repeated fields
+func (f protoFields) last(field int) (protoValue, bool) {
+	values := f[field]
+	if len(values) == 0 {
+		return protoValue{}, false
+	}
+	return values[len(values)-1], true
+}
+
+func (f protoFields) uint(field int) uint64 {
+	value, _ := f.last(field)
+	return value.number
+}
+
+func (f protoFields) int(field int) int64 {
+	return int64(f.uint(field))
+}
+
+func (f protoFields) bool(field int) bool {
+	return f.uint(field) != 0
+}
+
+func (f protoFields) float(field int) float64 {
+	return float32ToFloat64(math.Float32frombits(uint32(f.uint(field))))
+}
+
+func (f protoFields) string(field int) string {
+	value, _ := f.last(field)
+	return string(value.data)
+}
+
+func (f protoFields) message(field int) (protoFields, error) {
+	value, _ := f.last(field)
+	return decodeProto(value.data)
+}
+
+// floats returns a repeated float field, packed or not
+func (f protoFields) floats(field int) []float64 {
+	floats := make([]float64, 0)
+	for _, value := range f[field] {
+		if value.wireType == protoFixed32 {
+			floats = append(floats, float32ToFloat64(math.Float32frombits(uint32(value.number))))
+			continue
+		}
+		for i := 0; i+4 <= len(value.data); i += 4 {
+			floats = append(floats, float32ToFloat64(math.Float32frombits(binary.LittleEndian.Uint32(value.data[i:]))))
+		}
+	}
+	return floats
+}
+
+// float32ToFloat64 widens a float32 to the shortest float64 that prints the
+// same, so 0.9 reads back as 0.9 rather than 0.8999999761581421
+func float32ToFloat64(value float32) float64 {
+	widened, _ := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'g', -1, 32), 64)
+	return widened
+}
@@ -0,0 +1,194 @@
+package genanki
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Card is a card read from a collection. Its embedded schedule holds the
+// card's stored state: Queue is the queue the card is in, and Position is set
+// for new cards.
+type Card struct {
+	ID     int64
+	NoteID int64
+	DeckID int64
+	// OriginalDeckID is the home deck of a card in a filtered deck, or 0
+	OriginalDeckID int64
+	Ord            int
+	Modified       time.Time
+	CardSchedule
+}
+
+// NoteFilter selects the notes Database.Notes returns. Zero fields match
+// every note.
+type NoteFilter struct {
+	ModelID int64
+	// DeckID matches notes with a card in the deck, not its subdecks
+	DeckID int64
+	// Tag matches notes with the tag, ignoring case as Anki does
+	Tag string
+}
+
+// CardFilter selects the cards Database.Cards returns. Zero fields match
+// every card.
+type CardFilter struct {
+	NoteID int64
+	// DeckID matches cards in the deck, not its subdecks
+	DeckID int64
+	// Ords matches cards of the given template (or cloze) ordinals
+	Ords []int
+}
+
+// Notes returns the collection's notes matching the filter, or all notes for
+// a nil filter, in ID order
+func (d *Database) Notes(filter *NoteFilter) ([]*Note, error) {
+	if filter == nil {
+		filter = &NoteFilter{}
+	}
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	if filter.ModelID != 0 {
+		conditions = append(conditions, "mid = ?")
+		args = append(args, filter.ModelID)
+	}
+	if filter.DeckID != 0 {
+		conditions = append(conditions, "id IN (SELECT nid FROM cards WHERE did = ?)")
+		args = append(args, filter.DeckID)
+	}
+
+	notes, err := queryNotes(d.db, whereClause(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Tag == "" {
+		return notes, nil
+	}
+
+	tagged := make([]*Note, 0, len(notes))
+	for _, note := range notes {
+		for _, tag := range note.Tags {
+			if strings.EqualFold(tag, filter.Tag) {
+				tagged = append(tagged, note)
+				break
+			}
+		}
+	}
+	return tagged, nil
+}
+
+// Cards returns the collection's cards matching the filter, or all cards for
+// a nil filter, ordered by note and ordinal
+func (d *Database) Cards(filter *CardFilter) ([]*Card, error) {
+	if filter == nil {
+		filter = &CardFilter{}
+	}
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	if filter.NoteID != 0 {
+		conditions = append(conditions, "nid = ?")
+		args = append(args, filter.NoteID)
+	}
+	if filter.DeckID != 0 {
+		conditions = append(conditions, "did = ?")
+		args = append(args, filter.DeckID)
+	}
+	if len(filter.Ords) > 0 {
+		placeholders := make([]string, len(filter.Ords))
+		for i, ord := range filter.Ords {
+			placeholders[i] = "?"
+			args = append(args, ord)
+		}
+		conditions = append(conditions, "ord IN ("+strings.Join(placeholders, ", ")+")")
+	}
+
+	return d.cards(whereClause(conditions), args...)
+}
+
+// cards returns the cards matching a WHERE clause, converting their due
+// values with the collection's creation time
+func (d *Database) cards(where string, args ...interface{}) ([]*Card, error) {
+	// A collection without a col row has no cards yet
+	var crt int64
+	err := d.db.QueryRow("SELECT crt FROM col WHERE id = 1").Scan(&crt)
+	if err == sql.ErrNoRows {
+		return make([]*Card, 0), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection: %v", err)
+	}
+
+	return queryCards(d.db, crt, where, args...)
+}
+
+// CardsByNote returns the cards of a note, ordered by ordinal
+func (d *Database) CardsByNote(noteID int64) ([]*Card, error) {
+	return d.Cards(&CardFilter{NoteID: noteID})
+}
+
+// CardsByDeck returns the cards in a deck, not including its subdecks
+func (d *Database) CardsByDeck(deckID int64) ([]*Card, error) {
+	return d.Cards(&CardFilter{DeckID: deckID})
+}
+
+// CardsByOrd returns the cards of a template (or cloze) ordinal across all
+// notes
+func (d *Database) CardsByOrd(ord int) ([]*Card, error) {
+	return d.Cards(&CardFilter{Ords: []int{ord}})
+}
+
+// Models returns the collection's models in ID order
+func (d *Database) Models() ([]*Model, error) {
+	var modelsJSON string
+	err := d.db.QueryRow("SELECT models FROM col WHERE id = 1").Scan(&modelsJSON)
+	if err == sql.ErrNoRows {
+		return make([]*Model, 0), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read models: %v", err)
+	}
+	return modelsFromJSON(modelsJSON)
+}
+
+// Decks returns the collection's regular decks in ID order with their option
+// groups. Subdecks are listed by their full "Parent::Child" name rather than
+// nested, and the decks hold no notes; use Notes with a DeckID filter for those.
+func (d *Database) Decks() ([]*Deck, error) {
+	decks, _, err := d.readDecks()
+	return decks, err
+}
+
+// FilteredDecks returns the collection's filtered decks in ID order
+func (d *Database) FilteredDecks() ([]*FilteredDeck, error) {
+	_, filtered, err := d.readDecks()
+	return filtered, err
+}
+
+func (d *Database) readDecks() ([]*Deck, []*FilteredDeck, error) {
+	var decksJSON, dconfJSON string
+	err := d.db.QueryRow("SELECT decks, dconf FROM col WHERE id = 1").Scan(&decksJSON, &dconfJSON)
+	if err == sql.ErrNoRows {
+		return make([]*Deck, 0), make([]*FilteredDeck, 0), nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read decks: %v", err)
+	}
+
+	options, err := deckOptionsFromJSON(dconfJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decksFromJSON(decksJSON, options)
+}
+
+// whereClause joins SQL conditions into a WHERE clause, or returns an empty
+// string for none
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
@@ -0,0 +1,770 @@
+package genanki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultDeckID is the ID of the "Default" deck every Anki collection has
+const defaultDeckID = 1
+
+// OpenPackage reads an .apkg file into a Package whose models, decks, notes
+// and media can be inspected, changed and written again with WriteToFile
+func OpenPackage(path string) (*Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat package: %v", err)
+	}
+	return ReadPackage(f, info.Size())
+}
+
+// ReadPackage reads an .apkg archive of the given size from r. Notes are
+// placed in the deck of their first card, and their other cards keep their
+// own decks through CardSchedule.DeckID. Cards that are not new keep their
+// scheduling state and review history.
+func ReadPackage(r io.ReaderAt, size int64) (*Package, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	if files["collection.anki21b"] != nil {
+		return readLatestPackage(files)
+	}
+
+	collection := files["collection.anki21"]
+	if collection == nil {
+		collection = files["collection.anki2"]
+	}
+	if collection == nil {
+		return nil, fmt.Errorf("package has no collection")
+	}
+
+	collectionData, err := readZipFile(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := readCollection(collectionData)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaFile := files["media"]; mediaFile != nil {
+		mediaJSON, err := readZipFile(mediaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		mediaMap := make(map[string]string)
+		if err := json.Unmarshal(mediaJSON, &mediaMap); err != nil {
+			return nil, fmt.Errorf("failed to parse media map: %v", err)
+		}
+		for entry, filename := range mediaMap {
+			file := files[entry]
+			if file == nil {
+				return nil, fmt.Errorf("media file %q (%s) is missing from the package", filename, entry)
+			}
+			data, err := readZipFile(file)
+			if err != nil {
+				return nil, err
+			}
+			pkg.media[filename] = data
+		}
+	}
+
+	return pkg, nil
+}
+
+// readLatestPackage reads a package with a zstd-compressed collection.anki21b,
+// whose media files are compressed and listed in a protobuf media map
+func readLatestPackage(files map[string]*zip.File) (*Package, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	readCompressed := func(file *zip.File) ([]byte, error) {
+		compressed, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		data, err := decoder.DecodeAll(compressed, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %v", file.Name, err)
+		}
+		return data, nil
+	}
+
+	collectionData, err := readCompressed(files["collection.anki21b"])
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := readCollection(collectionData)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaFile := files["media"]
+	if mediaFile == nil {
+		return pkg, nil
+	}
+	mediaData, err := readCompressed(mediaFile)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := decodeProto(mediaData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse media map: %v", err)
+	}
+
+	for i, value := range entries[1] {
+		entry, err := decodeProto(value.data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse media map: %v", err)
+		}
+		filename := entry.string(1)
+
+		file := files[strconv.Itoa(i)]
+		if file == nil {
+			return nil, fmt.Errorf("media file %q (%d) is missing from the package", filename, i)
+		}
+		data, err := readCompressed(file)
+		if err != nil {
+			return nil, err
+		}
+		pkg.media[filename] = data
+	}
+	return pkg, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", file.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file.Name, err)
+	}
+	return data, nil
+}
+
+// readCollection loads a schema 11 or schema 18 collection into a new package
+func readCollection(data []byte) (*Package, error) {
+	tmpFile, err := os.CreateTemp("", "anki-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write collection: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write collection: %v", err)
+	}
+
+	db, err := sql.Open(sqliteDriver, tmpFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open collection: %v", err)
+	}
+	defer db.Close()
+
+	var crt, ver int64
+	if err := db.QueryRow("SELECT crt, ver FROM col").Scan(&crt, &ver); err != nil {
+		return nil, fmt.Errorf("failed to read collection: %v", err)
+	}
+
+	var models []*Model
+	var options map[int64]*DeckOptions
+	var decks []*Deck
+	var filtered []*FilteredDeck
+	if ver >= schema18Version {
+		models, options, decks, filtered, err = readSchema18Collection(db)
+	} else {
+		models, options, decks, filtered, err = readLegacyCollection(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	notes, noteOrder, err := readNotes(db)
+	if err != nil {
+		return nil, err
+	}
+	noteDecks, err := readCards(db, notes, crt)
+	if err != nil {
+		return nil, err
+	}
+
+	decksByID := make(map[int64]*Deck, len(decks))
+	for _, deck := range decks {
+		decksByID[deck.ID] = deck
+	}
+	// Cards in a deck the collection lacks go to Default
+	deckFor := func(deckID int64) *Deck {
+		if deck := decksByID[deckID]; deck != nil {
+			return deck
+		}
+		deck := decksByID[defaultDeckID]
+		if deck == nil {
+			deck = NewDeck(defaultDeckID, "Default", "")
+			decksByID[defaultDeckID] = deck
+			decks = append([]*Deck{deck}, decks...)
+		}
+		return deck
+	}
+
+	usedDecks := make(map[int64]bool)
+	for _, noteID := range noteOrder {
+		deckID, ok := noteDecks[noteID]
+		if !ok {
+			deckID = defaultDeckID
+		}
+		deck := deckFor(deckID)
+		note := notes[noteID]
+		deck.Notes = append(deck.Notes, note)
+
+		for _, schedule := range note.Schedules {
+			if schedule.DeckID == 0 {
+				continue
+			}
+			schedule.DeckID = deckFor(schedule.DeckID).ID
+			if schedule.DeckID == deck.ID {
+				schedule.DeckID = 0
+				continue
+			}
+			usedDecks[schedule.DeckID] = true
+		}
+	}
+
+	// Every collection has a Default deck; keep it only if it holds cards
+	kept := make([]*Deck, 0, len(decks))
+	for _, deck := range decks {
+		if deck.ID == defaultDeckID && len(deck.Notes) == 0 && !usedDecks[deck.ID] {
+			continue
+		}
+		kept = append(kept, deck)
+	}
+
+	pkg := NewPackage(kept)
+	for _, model := range models {
+		pkg.AddModel(model)
+	}
+	optionIDs := make([]int64, 0, len(options))
+	for id := range options {
+		optionIDs = append(optionIDs, id)
+	}
+	sort.Slice(optionIDs, func(i, j int) bool { return optionIDs[i] < optionIDs[j] })
+	for _, id := range optionIDs {
+		pkg.AddDeckOptions(options[id])
+	}
+	for _, deck := range filtered {
+		pkg.AddFilteredDeck(deck)
+	}
+	return pkg, nil
+}
+
+// readSchema18Collection reads the note types, option groups and decks from
+// the tables of a schema 18 collection
+func readSchema18Collection(db *sql.DB) ([]*Model, map[int64]*DeckOptions, []*Deck, []*FilteredDeck, error) {
+	models, err := schema18Models(db)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	options, err := schema18DeckOptions(db)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	decks, filtered, err := schema18Decks(db, options)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return models, options, decks, filtered, nil
+}
+
+// readLegacyCollection reads the models, option groups and decks from the
+// JSON columns of a schema 11 collection
+func readLegacyCollection(db *sql.DB) ([]*Model, map[int64]*DeckOptions, []*Deck, []*FilteredDeck, error) {
+	var modelsJSON, decksJSON, dconfJSON string
+	if err := db.QueryRow("SELECT models, decks, dconf FROM col").Scan(&modelsJSON, &decksJSON, &dconfJSON); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to read collection: %v", err)
+	}
+
+	models, err := modelsFromJSON(modelsJSON)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	options, err := deckOptionsFromJSON(dconfJSON)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	decks, filtered, err := decksFromJSON(decksJSON, options)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return models, options, decks, filtered, nil
+}
+
+// sortedKeys returns the keys of a col JSON object in ascending ID order
+func sortedKeys[V any](entries map[string]V) ([]string, error) {
+	keys := make([]string, 0, len(entries))
+	ids := make(map[string]int64, len(entries))
+	for key := range entries {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q: %v", key, err)
+		}
+		ids[key] = id
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return ids[keys[i]] < ids[keys[j]] })
+	return keys, nil
+}
+
+type modelJSON struct {
+	Name  string `json:"name"`
+	CSS   string `json:"css"`
+	Sortf int    `json:"sortf"`
+	Flds  []struct {
+		Name   string `json:"name"`
+		Ord    int    `json:"ord"`
+		Sticky bool   `json:"sticky"`
+		RTL    bool   `json:"rtl"`
+		Font   string `json:"font"`
+		Size   int    `json:"size"`
+		Color  string `json:"color"`
+		Align  string `json:"align"`
+	} `json:"flds"`
+	Tmpls []struct {
+		Name  string `json:"name"`
+		Ord   int    `json:"ord"`
+		Qfmt  string `json:"qfmt"`
+		Afmt  string `json:"afmt"`
+		Bqfmt string `json:"bqfmt"`
+		Bafmt string `json:"bafmt"`
+	} `json:"tmpls"`
+}
+
+func modelsFromJSON(data string) ([]*Model, error) {
+	var entries map[string]modelJSON
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse models: %v", err)
+	}
+	keys, err := sortedKeys(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse models: %v", err)
+	}
+
+	models := make([]*Model, 0, len(entries))
+	for _, key := range keys {
+		entry := entries[key]
+		id, _ := strconv.ParseInt(key, 10, 64)
+
+		model := NewModel(id, entry.Name)
+		model.CSS = entry.CSS
+		model.SortFieldIndex = entry.Sortf
+		for _, field := range entry.Flds {
+			model.AddField(Field{
+				Name:   field.Name,
+				Ord:    field.Ord,
+				Sticky: field.Sticky,
+				RTF:    field.RTL,
+				Font:   field.Font,
+				Size:   field.Size,
+				Color:  field.Color,
+				Align:  field.Align,
+			})
+		}
+		for _, tmpl := range entry.Tmpls {
+			model.AddTemplate(Template{
+				Name:  tmpl.Name,
+				Ord:   tmpl.Ord,
+				Qfmt:  tmpl.Qfmt,
+				Afmt:  tmpl.Afmt,
+				Bqfmt: tmpl.Bqfmt,
+				Bafmt: tmpl.Bafmt,
+			})
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+type deckOptionsJSON struct {
+	Name string `json:"name"`
+	New  struct {
+		Delays        []float64 `json:"delays"`
+		Ints          []int     `json:"ints"`
+		InitialFactor int       `json:"initialFactor"`
+		PerDay        int       `json:"perDay"`
+		Bury          bool      `json:"bury"`
+	} `json:"new"`
+	Rev struct {
+		PerDay int  `json:"perDay"`
+		MaxIvl int  `json:"maxIvl"`
+		Bury   bool `json:"bury"`
+	} `json:"rev"`
+	Lapse struct {
+		Delays      []float64 `json:"delays"`
+		LeechFails  int       `json:"leechFails"`
+		LeechAction int       `json:"leechAction"`
+	} `json:"lapse"`
+	BuryInterdayLearning bool      `json:"buryInterdayLearning"`
+	DesiredRetention     float64   `json:"desiredRetention"`
+	FSRSWeights          []float64 `json:"fsrsWeights"`
+	FSRSParams5          []float64 `json:"fsrsParams5"`
+	FSRSParams6          []float64 `json:"fsrsParams6"`
+}
+
+func deckOptionsFromJSON(data string) (map[int64]*DeckOptions, error) {
+	var entries map[string]deckOptionsJSON
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse deck options: %v", err)
+	}
+	keys, err := sortedKeys(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse deck options: %v", err)
+	}
+
+	options := make(map[int64]*DeckOptions, len(entries))
+	for _, key := range keys {
+		entry := entries[key]
+		id, _ := strconv.ParseInt(key, 10, 64)
+
+		opts := NewDeckOptions(id, entry.Name)
+		opts.NewPerDay = entry.New.PerDay
+		opts.ReviewsPerDay = entry.Rev.PerDay
+		opts.LearningSteps = entry.New.Delays
+		opts.RelearningSteps = entry.Lapse.Delays
+		if len(entry.New.Ints) >= 2 {
+			opts.GraduatingInterval = entry.New.Ints[0]
+			opts.EasyInterval = entry.New.Ints[1]
+		}
+		opts.InitialEase = entry.New.InitialFactor
+		opts.MaximumInterval = entry.Rev.MaxIvl
+		opts.BuryNew = entry.New.Bury
+		opts.BuryReviews = entry.Rev.Bury
+		opts.BuryInterdayLearning = entry.BuryInterdayLearning
+		opts.LeechThreshold = entry.Lapse.LeechFails
+		opts.LeechAction = LeechAction(entry.Lapse.LeechAction)
+		if entry.DesiredRetention > 0 {
+			opts.DesiredRetention = entry.DesiredRetention
+		}
+
+		// Keep the parameters of the newest FSRS version present
+		for _, params := range [][]float64{entry.FSRSParams6, entry.FSRSParams5, entry.FSRSWeights} {
+			if len(params) > 0 {
+				opts.FSRSParams = params
+				break
+			}
+		}
+
+		options[id] = opts
+	}
+	return options, nil
+}
+
+type deckJSON struct {
+	Name    string          `json:"name"`
+	Desc    string          `json:"desc"`
+	Dyn     int             `json:"dyn"`
+	Conf    int64           `json:"conf"`
+	Resched bool            `json:"resched"`
+	Terms   [][]interface{} `json:"terms"`
+}
+
+func decksFromJSON(data string, options map[int64]*DeckOptions) ([]*Deck, []*FilteredDeck, error) {
+	var entries map[string]deckJSON
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse decks: %v", err)
+	}
+	keys, err := sortedKeys(entries)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse decks: %v", err)
+	}
+
+	decks := make([]*Deck, 0, len(entries))
+	filtered := make([]*FilteredDeck, 0)
+	for _, key := range keys {
+		entry := entries[key]
+		id, _ := strconv.ParseInt(key, 10, 64)
+
+		if entry.Dyn != 0 {
+			deck := &FilteredDeck{ID: id, Name: entry.Name, Desc: entry.Desc, Reschedule: entry.Resched}
+			for _, term := range entry.Terms {
+				if len(term) < 3 {
+					return nil, nil, fmt.Errorf("filtered deck %q has an invalid search term", entry.Name)
+				}
+				search, _ := term[0].(string)
+				limit, _ := term[1].(float64)
+				order, _ := term[2].(float64)
+				deck.AddTerm(search, int(limit), FilteredDeckOrder(order))
+			}
+			filtered = append(filtered, deck)
+			continue
+		}
+
+		deck := NewDeck(id, entry.Name, entry.Desc)
+		deck.Options = options[entry.Conf]
+		decks = append(decks, deck)
+	}
+	return decks, filtered, nil
+}
+
+// readNotes returns the collection's notes by ID, and their IDs in order
+func readNotes(db *sql.DB) (map[int64]*Note, []int64, error) {
+	list, err := queryNotes(db, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notes := make(map[int64]*Note, len(list))
+	order := make([]int64, len(list))
+	for i, note := range list {
+		notes[note.ID] = note
+		order[i] = note.ID
+	}
+	return notes, order, nil
+}
+
+// queryNotes returns the notes matching a WHERE clause (or all notes for an
+// empty one) in ID order, with the sort field and checksum stored for them
+func queryNotes(db *sql.DB, where string, args ...interface{}) ([]*Note, error) {
+	rows, err := db.Query("SELECT id, guid, mid, mod, tags, flds, CAST(sfld AS TEXT), csum FROM notes "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes: %v", err)
+	}
+	defer rows.Close()
+
+	notes := make([]*Note, 0)
+	for rows.Next() {
+		var id, mid, mod, csum int64
+		var guid, tags, flds, sfld string
+		if err := rows.Scan(&id, &guid, &mid, &mod, &tags, &flds, &sfld, &csum); err != nil {
+			return nil, fmt.Errorf("failed to read note: %v", err)
+		}
+
+		note := NewNote(mid, strings.Split(flds, "\x1f"), strings.Fields(tags))
+		note.ID = id
+		note.GUID = guid
+		note.Modified = time.Unix(mod, 0)
+		note.SortField = sfld
+		note.CheckSum = csum
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read notes: %v", err)
+	}
+	return notes, nil
+}
+
+// readCards restores the state of cards that are not plain new cards, or
+// that are in another deck than their note's first card, onto their notes,
+// and returns the deck of each note's first card
+func readCards(db *sql.DB, notes map[int64]*Note, crt int64) (map[int64]int64, error) {
+	cards, err := queryCards(db, crt, "")
+	if err != nil {
+		return nil, err
+	}
+
+	noteDecks := make(map[int64]int64)
+	for _, card := range cards {
+		note := notes[card.NoteID]
+		if note == nil {
+			continue
+		}
+
+		// Cards in a filtered deck belong to their original deck
+		did := card.DeckID
+		if card.OriginalDeckID != 0 {
+			did = card.OriginalDeckID
+		}
+		noteDeck, ok := noteDecks[card.NoteID]
+		if !ok {
+			noteDecks[card.NoteID] = did
+			noteDeck = did
+		}
+
+		schedule := card.CardSchedule
+		schedule.Position = 0
+		if did != noteDeck {
+			schedule.DeckID = did
+		}
+		if schedule.Queue == schedule.queueForType() {
+			schedule.Queue = QueueNew
+		}
+		if schedule.Type == CardTypeNew && schedule.Queue == QueueNew && schedule.Flag == FlagNone &&
+			len(schedule.CustomData) == 0 && len(schedule.Reviews) == 0 && schedule.DeckID == 0 {
+			continue
+		}
+		note.SetSchedule(card.Ord, &schedule)
+	}
+	return noteDecks, nil
+}
+
+// queryCards returns the cards matching a WHERE clause (or all cards for an
+// empty one) ordered by note and ordinal, with their review logs
+func queryCards(db *sql.DB, crt int64, where string, args ...interface{}) ([]*Card, error) {
+	reviews, err := readReviews(db, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, nid, did, ord, mod, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data
+		FROM cards `+where+` ORDER BY nid, ord
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cards: %v", err)
+	}
+	defer rows.Close()
+
+	cards := make([]*Card, 0)
+	for rows.Next() {
+		var id, nid, did, mod, due, odue, odid int64
+		var ord, cardType, queue, ivl, factor, reps, lapses, left, flags int
+		var data string
+		err := rows.Scan(&id, &nid, &did, &ord, &mod, &cardType, &queue, &due, &ivl, &factor, &reps, &lapses, &left, &odue, &odid, &flags, &data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read card: %v", err)
+		}
+
+		customData, err := customDataFromCard(data)
+		if err != nil {
+			return nil, fmt.Errorf("card %d: %v", id, err)
+		}
+
+		card := &Card{
+			ID:             id,
+			NoteID:         nid,
+			DeckID:         did,
+			OriginalDeckID: odid,
+			Ord:            ord,
+			Modified:       time.Unix(mod, 0),
+			CardSchedule: CardSchedule{
+				Type:       CardType(cardType),
+				Queue:      CardQueue(queue),
+				Interval:   ivl,
+				Ease:       factor,
+				Reps:       reps,
+				Lapses:     lapses,
+				Left:       left,
+				Reviews:    reviews[id],
+				Flag:       CardFlag(flags & 7),
+				CustomData: customData,
+			},
+		}
+
+		// A card in a filtered deck keeps its own due value in odue
+		if odid != 0 {
+			due = odue
+		}
+		if card.Type == CardTypeNew {
+			card.Position = due
+		}
+		card.Due = card.dueTime(card.Queue, due, crt)
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cards: %v", err)
+	}
+	return cards, nil
+}
+
+// readReviews returns the review log of each card matching a cards WHERE
+// clause in chronological order
+func readReviews(db *sql.DB, where string, args ...interface{}) (map[int64][]Review, error) {
+	rows, err := db.Query(`
+		SELECT id, cid, ease, ivl, lastIvl, factor, time, type
+		FROM revlog WHERE cid IN (SELECT id FROM cards `+where+`) ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read review log: %v", err)
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64][]Review)
+	for rows.Next() {
+		var id, cid, duration int64
+		var ease, ivl, lastIvl, factor, reviewType int
+		if err := rows.Scan(&id, &cid, &ease, &ivl, &lastIvl, &factor, &duration, &reviewType); err != nil {
+			return nil, fmt.Errorf("failed to read review: %v", err)
+		}
+		reviews[cid] = append(reviews[cid], Review{
+			Time:         time.UnixMilli(id),
+			Ease:         ease,
+			Interval:     ivl,
+			LastInterval: lastIvl,
+			Factor:       factor,
+			Duration:     time.Duration(duration) * time.Millisecond,
+			Type:         ReviewType(reviewType),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read review log: %v", err)
+	}
+	return reviews, nil
+}
+
+// customDataFromCard extracts the custom data from cards.data, where Anki
+// keeps it as a JSON string under "cd", formatting numeric values as text
+func customDataFromCard(data string) (map[string]string, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var parsed struct {
+		CustomData string `json:"cd"`
+	}
+	if err := json.Unmarshal([]byte(data), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse card data: %v", err)
+	}
+	if parsed.CustomData == "" {
+		return nil, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(parsed.CustomData), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse card custom data: %v", err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	customData := make(map[string]string, len(values))
+	for key, value := range values {
+		if text, ok := value.(string); ok {
+			customData[key] = text
+		} else {
+			customData[key] = fmt.Sprint(value)
+		}
+	}
+	return customData, nil
+}
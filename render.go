@@ -0,0 +1,236 @@
+package genanki
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// furiganaRegexp matches readings written as kanji[kana]
+var furiganaRegexp = regexp.MustCompile(` ?([^ >]+?)\[(.+?)\]`)
+
+// renderContext carries the state needed to render one side of a card
+type renderContext struct {
+	model     *Model
+	note      *Note
+	template  *Template
+	clozeOrd  int // cloze number being asked, only used for cloze models
+	answer    bool
+	frontSide string
+	// stripTypeAnswer drops type-in answer boxes, as Anki does when the
+	// question is embedded into the answer through {{FrontSide}}
+	stripTypeAnswer bool
+}
+
+// RenderCard renders the question and answer HTML of the card with the given
+// template ordinal (or cloze ordinal for cloze models) for note. Both sides are
+// wrapped in the model's CSS and Anki's ".card" container so the result can be
+// previewed directly in a browser.
+func RenderCard(model *Model, note *Note, ord int) (string, string, error) {
+	question, answer, err := renderCardContent(model, note, ord)
+	if err != nil {
+		return "", "", err
+	}
+
+	return wrapCardHTML(model, ord, question), wrapCardHTML(model, ord, answer), nil
+}
+
+// renderCardContent renders both sides of a card without the CSS wrapper
+func renderCardContent(model *Model, note *Note, ord int) (string, string, error) {
+	ctx := &renderContext{model: model, note: note}
+
+	if getModelType(model) == 1 {
+		if len(model.Templates) == 0 {
+			return "", "", fmt.Errorf("model %q has no templates", model.Name)
+		}
+		if ord < 0 {
+			return "", "", fmt.Errorf("invalid cloze ordinal %d", ord)
+		}
+		ctx.template = &model.Templates[0]
+		ctx.clozeOrd = ord + 1
+	} else {
+		if ord < 0 || ord >= len(model.Templates) {
+			return "", "", fmt.Errorf("model %q has no template with ordinal %d", model.Name, ord)
+		}
+		ctx.template = &model.Templates[ord]
+	}
+
+	question, err := ctx.render(ctx.template.Qfmt)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render question of template %q: %v", ctx.template.Name, err)
+	}
+
+	ctx.stripTypeAnswer = true
+	frontSide, err := ctx.render(ctx.template.Qfmt)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render question of template %q: %v", ctx.template.Name, err)
+	}
+
+	ctx.stripTypeAnswer = false
+	ctx.answer = true
+	ctx.frontSide = frontSide
+	answer, err := ctx.render(ctx.template.Afmt)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render answer of template %q: %v", ctx.template.Name, err)
+	}
+
+	return question, answer, nil
+}
+
+func wrapCardHTML(model *Model, ord int, body string) string {
+	return fmt.Sprintf("<style>%s</style><div class=\"card card%d\">%s</div>", model.CSS, ord+1, body)
+}
+
+func (ctx *renderContext) render(format string) (string, error) {
+	nodes, err := parseTemplate(format)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := ctx.renderNodes(&sb, nodes); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func (ctx *renderContext) renderNodes(sb *strings.Builder, nodes []templateNode) error {
+	for _, node := range nodes {
+		switch node.kind {
+		case textNode:
+			sb.WriteString(node.text)
+		case replacementNode:
+			text, err := ctx.renderReplacement(node)
+			if err != nil {
+				return err
+			}
+			sb.WriteString(text)
+		case conditionalNode, negatedConditionalNode:
+			value, err := ctx.fieldValue(node.key)
+			if err != nil {
+				return err
+			}
+			nonempty := !emptyFieldRegexp.MatchString(value)
+			if nonempty == (node.kind == conditionalNode) {
+				if err := ctx.renderNodes(sb, node.children); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fieldValue resolves a field name or one of Anki's special fields
+func (ctx *renderContext) fieldValue(key string) (string, error) {
+	for i, field := range ctx.model.Fields {
+		if field.Name == key {
+			if i < len(ctx.note.Fields) {
+				return ctx.note.Fields[i], nil
+			}
+			return "", nil
+		}
+	}
+
+	switch key {
+	case "FrontSide":
+		return ctx.frontSide, nil
+	case "Tags":
+		return strings.Join(ctx.note.Tags, " "), nil
+	case "Type":
+		return ctx.model.Name, nil
+	case "Card":
+		return ctx.template.Name, nil
+	case "Deck", "Subdeck", "CardFlag":
+		return "", nil
+	}
+
+	return "", fmt.Errorf("unknown field %q", key)
+}
+
+func (ctx *renderContext) renderReplacement(node templateNode) (string, error) {
+	if node.key == "FrontSide" && len(node.filters) == 0 {
+		if ctx.answer {
+			return ctx.frontSide, nil
+		}
+		return "", nil
+	}
+
+	text, err := ctx.fieldValue(node.key)
+	if err != nil {
+		return "", err
+	}
+
+	for i, filter := range node.filters {
+		switch filter {
+		case "type":
+			return ctx.renderTypeAnswer(node.key, text, node.filters[:i]), nil
+		case "cloze":
+			text = renderCloze(text, ctx.clozeOrd, ctx.answer)
+		case "cloze-only":
+			text = clozeOnly(text, ctx.clozeOrd)
+		case "text":
+			text = stripHTML(text)
+		case "hint":
+			text = renderHint(node.key, text)
+		case "furigana":
+			text = renderFurigana(text, "<ruby><rb>$1</rb><rt>$2</rt></ruby>")
+		case "kana":
+			text = renderFurigana(text, "$2")
+		case "kanji":
+			text = renderFurigana(text, "$1")
+		}
+	}
+
+	return text, nil
+}
+
+// renderTypeAnswer renders a type-in answer box on the question side and the
+// expected answer on the answer side. The filters that precede "type" (such as
+// "cloze" in {{type:cloze:Text}}) select what the expected answer is.
+func (ctx *renderContext) renderTypeAnswer(key, text string, filters []string) string {
+	if ctx.stripTypeAnswer {
+		return ""
+	}
+	if !ctx.answer {
+		return "<center><input type=text id=typeans></center>"
+	}
+
+	expected := text
+	for _, filter := range filters {
+		if filter == "cloze" {
+			expected = clozeOnly(text, ctx.clozeOrd)
+		}
+	}
+	return fmt.Sprintf("<center><code id=typeans>%s</code></center>", html.EscapeString(stripHTML(expected)))
+}
+
+func renderHint(fieldName, text string) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	id := strconv.FormatUint(h.Sum64(), 16)
+
+	return fmt.Sprintf(
+		`<a class=hint href="#" onclick="this.style.display='none';document.getElementById('hint%s').style.display='block';return false;" draggable=false>%s</a><div id="hint%s" class=hint style="display: none">%s</div>`,
+		id, html.EscapeString(fieldName), id, text,
+	)
+}
+
+func renderFurigana(text, replacement string) string {
+	text = strings.ReplaceAll(text, "&nbsp;", " ")
+	return furiganaRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		groups := furiganaRegexp.FindStringSubmatch(match)
+		if strings.HasPrefix(groups[2], "sound:") {
+			// [sound:...] tags are not readings
+			return match
+		}
+		return furiganaRegexp.ReplaceAllString(match, replacement)
+	})
+}
@@ -0,0 +1,315 @@
+package genanki
+
+import (
+	"fmt"
+	"time"
+)
+
+// rolloverHour is the local hour at which Anki starts a new day by default
+const rolloverHour = 4
+
+// CardType is the scheduling state of a card
+type CardType int
+
+const (
+	CardTypeNew        CardType = 0
+	CardTypeLearning   CardType = 1
+	CardTypeReview     CardType = 2
+	CardTypeRelearning CardType = 3
+)
+
+// CardQueue is the queue Anki shows a card from
+type CardQueue int
+
+const (
+	QueueUserBuried  CardQueue = -3
+	QueueBuried      CardQueue = -2
+	QueueSuspended   CardQueue = -1
+	QueueNew         CardQueue = 0
+	QueueLearning    CardQueue = 1
+	QueueReview      CardQueue = 2
+	QueueDayLearning CardQueue = 3
+	QueuePreview     CardQueue = 4
+)
+
+// ReviewType is the kind of answer recorded in the review log
+type ReviewType int
+
+const (
+	ReviewLearn    ReviewType = 0
+	ReviewReview   ReviewType = 1
+	ReviewRelearn  ReviewType = 2
+	ReviewFiltered ReviewType = 3
+	ReviewManual   ReviewType = 4
+)
+
+// Review is one answer in a card's review history
+type Review struct {
+	Time time.Time
+	// Ease is the answer button: 1 (again) to 4 (easy)
+	Ease int
+	// Interval and LastInterval follow Anki's revlog convention: positive
+	// values are days, negative values are seconds
+	Interval     int
+	LastInterval int
+	Factor       int // permille
+	Duration     time.Duration
+	Type         ReviewType
+}
+
+// CardSchedule is the scheduling state a card is created with, used to carry
+// progress over from another spaced repetition system
+type CardSchedule struct {
+	Type CardType
+	// Queue defaults to the queue matching Type when left as QueueNew
+	Queue CardQueue
+	// Due is when a learning or review card is next shown
+	Due time.Time
+	// Position orders new cards; WriteToFile assigns it when left as 0
+	Position int64
+	Interval int // days
+	Ease     int // permille, defaults to 2500
+	Reps     int
+	Lapses   int
+	// Left is the number of learning steps remaining, encoded as Anki does
+	Left    int
+	Reviews []Review
+	Flag    CardFlag
+	// CustomData is stored in the card for custom scheduling code
+	CustomData map[string]string
+	// DeckID puts the card in another deck of the package than its note's;
+	// 0 keeps it with the note
+	DeckID int64
+}
+
+// SetSchedule sets the scheduling state of the note's card with the given
+// template (or cloze) ordinal
+func (n *Note) SetSchedule(ord int, schedule *CardSchedule) *Note {
+	if n.Schedules == nil {
+		n.Schedules = make(map[int]*CardSchedule)
+	}
+	n.Schedules[ord] = schedule
+	return n
+}
+
+// queue returns the card queue, deriving it from the card type if unset
+func (s *CardSchedule) queue() CardQueue {
+	if s.Queue != QueueNew {
+		return s.Queue
+	}
+	return s.queueForType()
+}
+
+// queueForType returns the queue a card of the schedule's type is usually in
+func (s *CardSchedule) queueForType() CardQueue {
+	switch s.Type {
+	case CardTypeLearning, CardTypeRelearning:
+		return QueueLearning
+	case CardTypeReview:
+		return QueueReview
+	}
+	return QueueNew
+}
+
+// dueValue converts Due into the value Anki stores for the card's queue:
+// a timestamp in seconds for intraday learning, or the number of days since
+// the collection was created (crt) for reviews and interday learning
+func (s *CardSchedule) dueValue(queue CardQueue, crt int64) int64 {
+	switch queue {
+	case QueueNew:
+		return s.Position
+	case QueueLearning, QueuePreview:
+		return s.Due.Unix()
+	case QueueReview, QueueDayLearning:
+		return dayNumber(s.Due, crt)
+	}
+
+	// Suspended and buried cards keep the due value of their card type
+	switch s.Type {
+	case CardTypeLearning, CardTypeRelearning:
+		return s.Due.Unix()
+	case CardTypeReview:
+		return dayNumber(s.Due, crt)
+	}
+	return s.Position
+}
+
+// dueTime converts a due value stored for the given queue back into a time,
+// reversing dueValue. New cards have no due time.
+func (s *CardSchedule) dueTime(queue CardQueue, due int64, crt int64) time.Time {
+	switch queue {
+	case QueueNew:
+		return time.Time{}
+	case QueueLearning, QueuePreview:
+		return time.Unix(due, 0)
+	case QueueReview, QueueDayLearning:
+		return dayTime(due, crt)
+	}
+
+	switch s.Type {
+	case CardTypeLearning, CardTypeRelearning:
+		return time.Unix(due, 0)
+	case CardTypeReview:
+		return dayTime(due, crt)
+	}
+	return time.Time{}
+}
+
+// dayTime returns the start of the given Anki day after the collection
+// creation time crt, reversing dayNumber
+func dayTime(day int64, crt int64) time.Time {
+	created := time.Unix(crt, 0).Local().Add(-rolloverHour * time.Hour)
+	start := time.Date(created.Year(), created.Month(), created.Day(), rolloverHour, 0, 0, 0, time.Local)
+	return start.AddDate(0, 0, int(day))
+}
+
+// dayNumber returns the number of Anki days between the collection creation
+// time crt and t, as used for review due dates. Days start at the rollover
+// hour in local time.
+func dayNumber(t time.Time, crt int64) int64 {
+	day := func(t time.Time) time.Time {
+		t = t.Local().Add(-rolloverHour * time.Hour)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int64(day(t).Sub(day(time.Unix(crt, 0))).Hours() / 24)
+}
+
+func (s *CardSchedule) validate() error {
+	if s.Type < CardTypeNew || s.Type > CardTypeRelearning {
+		return fmt.Errorf("unknown card type %d", s.Type)
+	}
+	if s.Type != CardTypeNew && s.Due.IsZero() {
+		return fmt.Errorf("card of type %d has no due date", s.Type)
+	}
+	if s.Queue < QueueUserBuried || s.Queue > QueuePreview {
+		return fmt.Errorf("unknown card queue %d", s.Queue)
+	}
+	if s.Flag < FlagNone || s.Flag > FlagPurple {
+		return fmt.Errorf("unknown flag %d", s.Flag)
+	}
+	if _, err := cardData(s.CustomData); err != nil {
+		return err
+	}
+	for _, review := range s.Reviews {
+		if review.Ease < 0 || review.Ease > 4 {
+			return fmt.Errorf("review at %s has invalid ease %d", review.Time, review.Ease)
+		}
+		if review.Time.IsZero() {
+			return fmt.Errorf("review has no time")
+		}
+	}
+	return nil
+}
+
+// AddScheduledCard adds a card with the given scheduling state and writes its
+// review history to the revlog. A nil schedule adds a new card.
+func (d *Database) AddScheduledCard(noteID, deckID int64, templateOrd int, schedule *CardSchedule) (*Database, error) {
+	if schedule == nil {
+		schedule = &CardSchedule{}
+	}
+	if err := schedule.validate(); err != nil {
+		return nil, fmt.Errorf("invalid schedule for note %d card %d: %v", noteID, templateOrd, err)
+	}
+
+	// Due dates of scheduled cards are relative to the collection's creation
+	var crt int64
+	if !schedule.Due.IsZero() {
+		if err := d.db.QueryRow("SELECT crt FROM col WHERE id = 1").Scan(&crt); err != nil {
+			return nil, fmt.Errorf("failed to read collection creation time: %v", err)
+		}
+	}
+
+	ease := schedule.Ease
+	if ease == 0 {
+		ease = 2500
+	}
+	queue := schedule.queue()
+	data, err := cardData(schedule.CustomData)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	cardID := GenerateIntID()
+	_, err = tx.Exec(`
+		INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		cardID,
+		noteID,
+		deckID,
+		templateOrd,
+		time.Now().Unix(),
+		-1,
+		int(schedule.Type),
+		int(queue),
+		schedule.dueValue(queue, crt),
+		schedule.Interval,
+		ease,
+		schedule.Reps,
+		schedule.Lapses,
+		schedule.Left,
+		0, // no original due date
+		0, // no original deck
+		int(schedule.Flag),
+		data,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, review := range schedule.Reviews {
+		// Revlog IDs are millisecond timestamps; move along on collisions
+		id := review.Time.UnixMilli()
+		for {
+			var exists int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM revlog WHERE id = ?", id).Scan(&exists); err != nil {
+				return nil, fmt.Errorf("failed to check revlog: %v", err)
+			}
+			if exists == 0 {
+				break
+			}
+			id++
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO revlog (id, cid, usn, ease, ivl, lastIvl, factor, time, type)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			id,
+			cardID,
+			-1,
+			review.Ease,
+			review.Interval,
+			review.LastInterval,
+			review.Factor,
+			review.Duration.Milliseconds(),
+			int(review.Type),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert review: %v", err)
+		}
+	}
+
+	// Keep the next position Anki assigns to added cards past this one
+	if schedule.Type == CardTypeNew {
+		_, err = tx.Exec(
+			"UPDATE col SET conf = json_set(conf, '$.nextPos', ?) WHERE id = 1 AND json_extract(conf, '$.nextPos') <= ?",
+			schedule.Position+1,
+			schedule.Position,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update next card position: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return d, nil
+}
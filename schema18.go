@@ -0,0 +1,684 @@
+package genanki
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schema18Version is the collection schema of collection.anki21b
+const schema18Version = 18
+
+// schema18Tables are the tables schema 18 adds or changes. The graves table
+// is created before the shared tables, so initialize leaves it alone.
+var schema18Tables = []string{
+	`CREATE TABLE graves (
+		oid INTEGER NOT NULL,
+		type INTEGER NOT NULL,
+		usn INTEGER NOT NULL,
+		PRIMARY KEY (oid, type)
+	) WITHOUT ROWID`,
+	`CREATE TABLE deck_config (
+		id INTEGER PRIMARY KEY NOT NULL,
+		name TEXT NOT NULL COLLATE unicase,
+		mtime_secs INTEGER NOT NULL,
+		usn INTEGER NOT NULL,
+		config BLOB NOT NULL
+	)`,
+	`CREATE TABLE config (
+		KEY TEXT NOT NULL PRIMARY KEY,
+		usn INTEGER NOT NULL,
+		mtime_secs INTEGER NOT NULL,
+		val BLOB NOT NULL
+	) WITHOUT ROWID`,
+	`CREATE TABLE fields (
+		ntid INTEGER NOT NULL,
+		ord INTEGER NOT NULL,
+		name TEXT NOT NULL COLLATE unicase,
+		config BLOB NOT NULL,
+		PRIMARY KEY (ntid, ord)
+	) WITHOUT ROWID`,
+	`CREATE UNIQUE INDEX idx_fields_name_ntid ON fields (name, ntid)`,
+	`CREATE TABLE templates (
+		ntid INTEGER NOT NULL,
+		ord INTEGER NOT NULL,
+		name TEXT NOT NULL COLLATE unicase,
+		mtime_secs INTEGER NOT NULL,
+		usn INTEGER NOT NULL,
+		config BLOB NOT NULL,
+		PRIMARY KEY (ntid, ord)
+	) WITHOUT ROWID`,
+	`CREATE UNIQUE INDEX idx_templates_name_ntid ON templates (name, ntid)`,
+	`CREATE INDEX idx_templates_usn ON templates (usn)`,
+	`CREATE TABLE notetypes (
+		id INTEGER NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL COLLATE unicase,
+		mtime_secs INTEGER NOT NULL,
+		usn INTEGER NOT NULL,
+		config BLOB NOT NULL
+	)`,
+	`CREATE UNIQUE INDEX idx_notetypes_name ON notetypes (name)`,
+	`CREATE INDEX idx_notetypes_usn ON notetypes (usn)`,
+	`CREATE TABLE decks (
+		id INTEGER PRIMARY KEY NOT NULL,
+		name TEXT NOT NULL COLLATE unicase,
+		mtime_secs INTEGER NOT NULL,
+		usn INTEGER NOT NULL,
+		common BLOB NOT NULL,
+		kind BLOB NOT NULL
+	)`,
+	`CREATE UNIQUE INDEX idx_decks_name ON decks (name)`,
+	`CREATE TABLE tags (
+		tag TEXT NOT NULL PRIMARY KEY COLLATE unicase,
+		usn INTEGER NOT NULL,
+		collapsed BOOLEAN NOT NULL,
+		config BLOB NULL
+	) WITHOUT ROWID`,
+}
+
+// Anki's LaTeX header and footer for new note types
+const (
+	defaultLatexPre  = "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n"
+	defaultLatexPost = "\\end{document}"
+)
+
+// schema18DeckName converts a "::" separated deck name to the form schema 18
+// stores, and back
+func schema18DeckName(name string) string {
+	return strings.ReplaceAll(name, deckNameSeparator, "\x1f")
+}
+
+func legacyDeckName(name string) string {
+	return strings.ReplaceAll(name, "\x1f", deckNameSeparator)
+}
+
+// writeSchema18 writes the collection to path as a schema 18 database,
+// converting the JSON in the col table to schema 18's tables
+func (d *Database) writeSchema18(path string) error {
+	var crt, mod, scm int64
+	var confJSON, modelsJSON, decksJSON, dconfJSON string
+	err := d.db.QueryRow("SELECT crt, mod, scm, conf, models, decks, dconf FROM col WHERE id = 1").
+		Scan(&crt, &mod, &scm, &confJSON, &modelsJSON, &decksJSON, &dconfJSON)
+	if err != nil {
+		return fmt.Errorf("failed to read collection: %v", err)
+	}
+
+	models, err := modelsFromJSON(modelsJSON)
+	if err != nil {
+		return err
+	}
+	options, err := deckOptionsFromJSON(dconfJSON)
+	if err != nil {
+		return err
+	}
+	decks, filtered, err := decksFromJSON(decksJSON, options)
+	if err != nil {
+		return err
+	}
+
+	dest, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return fmt.Errorf("failed to open destination database: %v", err)
+	}
+	defer dest.Close()
+
+	for _, query := range schema18Tables {
+		if _, err := dest.Exec(query); err != nil {
+			return fmt.Errorf("failed to create schema: %v", err)
+		}
+	}
+	if err := (&Database{db: dest}).initialize(); err != nil {
+		return fmt.Errorf("failed to initialize destination database: %v", err)
+	}
+
+	tx, err := dest.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The JSON columns of col are unused from schema 18 on
+	_, err = tx.Exec(`
+		INSERT INTO col (id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags)
+		VALUES (1, ?, ?, ?, ?, 0, 0, 0, '', '', '', '', '')
+	`, crt, mod, scm, schema18Version)
+	if err != nil {
+		return fmt.Errorf("failed to write collection: %v", err)
+	}
+
+	for _, table := range []string{"notes", "cards", "revlog", "graves"} {
+		if err := copyTable(d.db, tx, table); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Unix()
+
+	if err := writeSchema18Config(tx, confJSON, now); err != nil {
+		return err
+	}
+
+	for _, model := range models {
+		config, err := notetypeConfig(model)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO notetypes (id, name, mtime_secs, usn, config) VALUES (?, ?, ?, -1, ?)",
+			model.ID, model.Name, now, config); err != nil {
+			return fmt.Errorf("failed to write note type %q: %v", model.Name, err)
+		}
+		for _, field := range model.Fields {
+			if _, err := tx.Exec("INSERT INTO fields (ntid, ord, name, config) VALUES (?, ?, ?, ?)",
+				model.ID, field.Ord, field.Name, fieldConfig(field)); err != nil {
+				return fmt.Errorf("failed to write field %q of note type %q: %v", field.Name, model.Name, err)
+			}
+		}
+		for _, template := range model.Templates {
+			if _, err := tx.Exec("INSERT INTO templates (ntid, ord, name, mtime_secs, usn, config) VALUES (?, ?, ?, ?, -1, ?)",
+				model.ID, template.Ord, template.Name, now, templateConfig(template)); err != nil {
+				return fmt.Errorf("failed to write template %q of note type %q: %v", template.Name, model.Name, err)
+			}
+		}
+	}
+
+	// Every collection has the Default option group and deck
+	if options[defaultDeckOptionsID] == nil {
+		options[defaultDeckOptionsID] = DefaultDeckOptions()
+	}
+	optionIDs := make([]int64, 0, len(options))
+	for id := range options {
+		optionIDs = append(optionIDs, id)
+	}
+	sort.Slice(optionIDs, func(i, j int) bool { return optionIDs[i] < optionIDs[j] })
+	for _, id := range optionIDs {
+		opts := options[id]
+		if _, err := tx.Exec("INSERT INTO deck_config (id, name, mtime_secs, usn, config) VALUES (?, ?, ?, -1, ?)",
+			opts.ID, opts.Name, now, deckConfigProto(opts)); err != nil {
+			return fmt.Errorf("failed to write deck options %q: %v", opts.Name, err)
+		}
+	}
+
+	hasDefault := false
+	for _, deck := range decks {
+		hasDefault = hasDefault || deck.ID == defaultDeckID
+	}
+	if !hasDefault {
+		decks = append(decks, NewDeck(defaultDeckID, "Default", ""))
+	}
+	for _, deck := range decks {
+		kind := newProtoMessage()
+		kind.message(1, normalDeckProto(deck))
+		if _, err := tx.Exec("INSERT INTO decks (id, name, mtime_secs, usn, common, kind) VALUES (?, ?, ?, -1, ?, ?)",
+			deck.ID, schema18DeckName(deck.Name), now, []byte{}, kind.buf); err != nil {
+			return fmt.Errorf("failed to write deck %q: %v", deck.Name, err)
+		}
+	}
+	for _, deck := range filtered {
+		common, err := filteredDeckCommon(deck)
+		if err != nil {
+			return err
+		}
+		kind := newProtoMessage()
+		kind.message(2, filteredDeckProto(deck))
+		if _, err := tx.Exec("INSERT INTO decks (id, name, mtime_secs, usn, common, kind) VALUES (?, ?, ?, -1, ?, ?)",
+			deck.ID, schema18DeckName(deck.Name), now, common, kind.buf); err != nil {
+			return fmt.Errorf("failed to write filtered deck %q: %v", deck.Name, err)
+		}
+	}
+
+	if err := writeSchema18Tags(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	if _, err := dest.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %v", err)
+	}
+	return nil
+}
+
+// copyTable copies every row of a table, matching columns by name
+func copyTable(src *sql.DB, tx *sql.Tx, table string) error {
+	rows, err := src.Query(fmt.Sprintf("SELECT * FROM %s", table))
+	if err != nil {
+		return fmt.Errorf("failed to get data from %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns for %s: %v", table, err)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), placeholders))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		valuePtrs := make([]interface{}, len(cols))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return fmt.Errorf("failed to scan row: %v", err)
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return fmt.Errorf("failed to insert row into %s: %v", table, err)
+		}
+	}
+	return rows.Err()
+}
+
+// writeSchema18Config moves the entries of col.conf to the config table.
+// Schema 18 collections use the v2 scheduler or later.
+func writeSchema18Config(tx *sql.Tx, confJSON string, now int64) error {
+	var conf map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(confJSON), &conf); err != nil {
+		return fmt.Errorf("failed to parse collection config: %v", err)
+	}
+	conf["schedVer"] = json.RawMessage("2")
+
+	for key, value := range conf {
+		if _, err := tx.Exec("INSERT INTO config (KEY, usn, mtime_secs, val) VALUES (?, -1, ?, ?)", key, now, []byte(value)); err != nil {
+			return fmt.Errorf("failed to write config %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// writeSchema18Tags registers the tags used by notes in the tags table
+func writeSchema18Tags(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT tags FROM notes")
+	if err != nil {
+		return fmt.Errorf("failed to read tags: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for rows.Next() {
+		var noteTags string
+		if err := rows.Scan(&noteTags); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read tags: %v", err)
+		}
+		for _, tag := range strings.Fields(noteTags) {
+			if key := strings.ToLower(tag); !seen[key] {
+				seen[key] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read tags: %v", err)
+	}
+
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO tags (tag, usn, collapsed) VALUES (?, -1, 0)", tag); err != nil {
+			return fmt.Errorf("failed to write tag %q: %v", tag, err)
+		}
+	}
+	return nil
+}
+
+// Card requirement kinds of the Notetype.Config message
+var requirementKinds = map[string]uint64{"none": 0, "any": 1, "all": 2}
+
+// notetypeConfig encodes a Notetype.Config message
+func notetypeConfig(model *Model) ([]byte, error) {
+	reqs, err := modelRequirements(model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute card requirements: %v", err)
+	}
+
+	config := newProtoMessage()
+	config.uint(1, uint64(getModelType(model)))
+	config.uint(2, uint64(model.SortFieldIndex))
+	config.string(3, model.CSS)
+	config.string(5, defaultLatexPre)
+	config.string(6, defaultLatexPost)
+	for _, req := range reqs {
+		entry := req.([]interface{})
+		fieldOrds := make([]byte, 0)
+		for _, ord := range entry[2].([]int) {
+			fieldOrds = binary.AppendUvarint(fieldOrds, uint64(ord))
+		}
+
+		requirement := newProtoMessage()
+		requirement.uint(1, uint64(entry[0].(int)))
+		requirement.uint(2, requirementKinds[entry[1].(string)])
+		requirement.bytes(3, fieldOrds)
+		config.message(8, requirement)
+	}
+	return config.buf, nil
+}
+
+// fieldConfig encodes a Notetype.Field.Config message
+func fieldConfig(field Field) []byte {
+	config := newProtoMessage()
+	config.bool(1, field.Sticky)
+	config.bool(2, field.RTF)
+	config.string(3, field.Font)
+	config.uint(4, uint64(field.Size))
+	return config.buf
+}
+
+// templateConfig encodes a Notetype.Template.Config message
+func templateConfig(template Template) []byte {
+	config := newProtoMessage()
+	config.string(1, template.Qfmt)
+	config.string(2, template.Afmt)
+	config.string(3, template.Bqfmt)
+	config.string(4, template.Bafmt)
+	return config.buf
+}
+
+// deckConfigProto encodes a DeckConfig.Config message with the settings
+// DeckOptions.config writes to col.dconf
+func deckConfigProto(opts *DeckOptions) []byte {
+	config := newProtoMessage()
+	config.floats(1, opts.LearningSteps)
+	config.floats(2, opts.RelearningSteps)
+	switch len(opts.FSRSParams) {
+	case 17:
+		config.floats(3, opts.FSRSParams)
+	case 19:
+		config.floats(5, opts.FSRSParams)
+	case 21:
+		config.floats(6, opts.FSRSParams)
+	}
+	config.uint(9, uint64(opts.NewPerDay))
+	config.uint(10, uint64(opts.ReviewsPerDay))
+	config.float(11, float32(opts.InitialEase)/1000)
+	config.float(12, 1.3)
+	config.float(13, 1.2)
+	config.float(15, 1.0)
+	config.uint(16, uint64(opts.MaximumInterval))
+	config.uint(17, 1)
+	config.uint(18, uint64(opts.GraduatingInterval))
+	config.uint(19, uint64(opts.EasyInterval))
+	config.uint(21, uint64(opts.LeechAction))
+	config.uint(22, uint64(opts.LeechThreshold))
+	config.uint(24, 60)
+	config.bool(27, opts.BuryNew)
+	config.bool(28, opts.BuryReviews)
+	config.bool(29, opts.BuryInterdayLearning)
+	config.float(37, float32(opts.DesiredRetention))
+	config.bool(44, true)
+	config.floats(47, []float64{1, 1, 1, 1, 1, 1, 1})
+	return config.buf
+}
+
+// normalDeckProto encodes a Deck.Normal message
+func normalDeckProto(deck *Deck) *protoMessage {
+	normal := newProtoMessage()
+	normal.int(1, deck.optionsID())
+	normal.uint(2, 10)
+	normal.uint(3, 50)
+	normal.string(4, deck.Desc)
+	return normal
+}
+
+// filteredDeckProto encodes a Deck.Filtered message
+func filteredDeckProto(deck *FilteredDeck) *protoMessage {
+	filtered := newProtoMessage()
+	filtered.bool(1, deck.Reschedule)
+	for _, term := range deck.Terms {
+		searchTerm := newProtoMessage()
+		searchTerm.string(1, term.Search)
+		searchTerm.uint(2, uint64(term.Limit))
+		searchTerm.uint(3, uint64(term.Order))
+		filtered.message(2, searchTerm)
+	}
+	filtered.uint(7, 60)
+	filtered.uint(5, 600)
+	return filtered
+}
+
+// filteredDeckCommon encodes the Deck.Common message of a filtered deck,
+// which keeps the description among its legacy JSON settings
+func filteredDeckCommon(deck *FilteredDeck) ([]byte, error) {
+	common := newProtoMessage()
+	if deck.Desc != "" {
+		other, err := json.Marshal(map[string]string{"desc": deck.Desc})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal deck description: %v", err)
+		}
+		common.bytes(255, other)
+	}
+	return common.buf, nil
+}
+
+// schema18Models reads the note types of a schema 18 collection
+func schema18Models(db *sql.DB) ([]*Model, error) {
+	rows, err := db.Query("SELECT id, name, config FROM notetypes ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note types: %v", err)
+	}
+	defer rows.Close()
+
+	models := make([]*Model, 0)
+	for rows.Next() {
+		var id int64
+		var name string
+		var blob []byte
+		if err := rows.Scan(&id, &name, &blob); err != nil {
+			return nil, fmt.Errorf("failed to read note type: %v", err)
+		}
+		config, err := decodeProto(blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode note type %q: %v", name, err)
+		}
+
+		model := NewModel(id, name)
+		model.CSS = config.string(3)
+		model.SortFieldIndex = int(config.uint(2))
+		models = append(models, model)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read note types: %v", err)
+	}
+
+	for _, model := range models {
+		if err := readSchema18Fields(db, model); err != nil {
+			return nil, err
+		}
+		if err := readSchema18Templates(db, model); err != nil {
+			return nil, err
+		}
+	}
+	return models, nil
+}
+
+func readSchema18Fields(db *sql.DB, model *Model) error {
+	rows, err := db.Query("SELECT ord, name, config FROM fields WHERE ntid = ? ORDER BY ord", model.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read fields of %q: %v", model.Name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ord int
+		var name string
+		var blob []byte
+		if err := rows.Scan(&ord, &name, &blob); err != nil {
+			return fmt.Errorf("failed to read field of %q: %v", model.Name, err)
+		}
+		config, err := decodeProto(blob)
+		if err != nil {
+			return fmt.Errorf("failed to decode field %q of %q: %v", name, model.Name, err)
+		}
+		model.AddField(Field{
+			Name:   name,
+			Ord:    ord,
+			Sticky: config.bool(1),
+			RTF:    config.bool(2),
+			Font:   config.string(3),
+			Size:   int(config.uint(4)),
+		})
+	}
+	return rows.Err()
+}
+
+func readSchema18Templates(db *sql.DB, model *Model) error {
+	rows, err := db.Query("SELECT ord, name, config FROM templates WHERE ntid = ? ORDER BY ord", model.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read templates of %q: %v", model.Name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ord int
+		var name string
+		var blob []byte
+		if err := rows.Scan(&ord, &name, &blob); err != nil {
+			return fmt.Errorf("failed to read template of %q: %v", model.Name, err)
+		}
+		config, err := decodeProto(blob)
+		if err != nil {
+			return fmt.Errorf("failed to decode template %q of %q: %v", name, model.Name, err)
+		}
+		model.AddTemplate(Template{
+			Name:  name,
+			Ord:   ord,
+			Qfmt:  config.string(1),
+			Afmt:  config.string(2),
+			Bqfmt: config.string(3),
+			Bafmt: config.string(4),
+		})
+	}
+	return rows.Err()
+}
+
+// schema18DeckOptions reads the option groups of a schema 18 collection
+func schema18DeckOptions(db *sql.DB) (map[int64]*DeckOptions, error) {
+	rows, err := db.Query("SELECT id, name, config FROM deck_config ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deck options: %v", err)
+	}
+	defer rows.Close()
+
+	options := make(map[int64]*DeckOptions)
+	for rows.Next() {
+		var id int64
+		var name string
+		var blob []byte
+		if err := rows.Scan(&id, &name, &blob); err != nil {
+			return nil, fmt.Errorf("failed to read deck options: %v", err)
+		}
+		config, err := decodeProto(blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode deck options %q: %v", name, err)
+		}
+
+		opts := NewDeckOptions(id, name)
+		opts.LearningSteps = config.floats(1)
+		opts.RelearningSteps = config.floats(2)
+		opts.NewPerDay = int(config.uint(9))
+		opts.ReviewsPerDay = int(config.uint(10))
+		opts.InitialEase = int(config.float(11)*1000 + 0.5)
+		opts.MaximumInterval = int(config.uint(16))
+		opts.GraduatingInterval = int(config.uint(18))
+		opts.EasyInterval = int(config.uint(19))
+		opts.LeechAction = LeechAction(config.uint(21))
+		opts.LeechThreshold = int(config.uint(22))
+		opts.BuryNew = config.bool(27)
+		opts.BuryReviews = config.bool(28)
+		opts.BuryInterdayLearning = config.bool(29)
+		if retention := config.float(37); retention > 0 {
+			opts.DesiredRetention = retention
+		}
+
+		// Keep the parameters of the newest FSRS version present
+		for _, field := range []int{6, 5, 3} {
+			if params := config.floats(field); len(params) > 0 {
+				opts.FSRSParams = params
+				break
+			}
+		}
+
+		options[id] = opts
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deck options: %v", err)
+	}
+	return options, nil
+}
+
+// schema18Decks reads the regular and filtered decks of a schema 18 collection
+func schema18Decks(db *sql.DB, options map[int64]*DeckOptions) ([]*Deck, []*FilteredDeck, error) {
+	rows, err := db.Query("SELECT id, name, common, kind FROM decks ORDER BY id")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read decks: %v", err)
+	}
+	defer rows.Close()
+
+	decks := make([]*Deck, 0)
+	filtered := make([]*FilteredDeck, 0)
+	for rows.Next() {
+		var id int64
+		var name string
+		var commonBlob, kindBlob []byte
+		if err := rows.Scan(&id, &name, &commonBlob, &kindBlob); err != nil {
+			return nil, nil, fmt.Errorf("failed to read deck: %v", err)
+		}
+		name = legacyDeckName(name)
+
+		kind, err := decodeProto(kindBlob)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode deck %q: %v", name, err)
+		}
+
+		if _, ok := kind.last(2); ok {
+			config, err := kind.message(2)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decode filtered deck %q: %v", name, err)
+			}
+			deck := &FilteredDeck{ID: id, Name: name, Reschedule: config.bool(1)}
+			for _, value := range config[2] {
+				term, err := decodeProto(value.data)
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to decode search of filtered deck %q: %v", name, err)
+				}
+				deck.AddTerm(term.string(1), int(term.uint(2)), FilteredDeckOrder(term.uint(3)))
+			}
+
+			common, err := decodeProto(commonBlob)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to decode filtered deck %q: %v", name, err)
+			}
+			var other struct {
+				Desc string `json:"desc"`
+			}
+			if raw := common.string(255); raw != "" {
+				json.Unmarshal([]byte(raw), &other)
+			}
+			deck.Desc = other.Desc
+
+			filtered = append(filtered, deck)
+			continue
+		}
+
+		config, err := kind.message(1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode deck %q: %v", name, err)
+		}
+		deck := NewDeck(id, name, config.string(4))
+		deck.Options = options[config.int(1)]
+		decks = append(decks, deck)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read decks: %v", err)
+	}
+	return decks, filtered, nil
+}
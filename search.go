@@ -0,0 +1,886 @@
+package genanki
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Search is a parsed query in Anki's search syntax, which can be evaluated
+// against a Package or run against a Database.
+//
+// Terms are separated by spaces and must all match, unless joined with "or".
+// Parentheses group terms, a leading "-" negates a term, and double quotes
+// keep spaces in a term. Supported terms are:
+//
+//	text         notes with text in a field; * and _ are wildcards
+//	field:value  notes whose field matches value as a whole; field:re:regex
+//	deck:name    cards in the deck or its subdecks
+//	tag:name     notes with the tag or one of its child tags; tag:none
+//	note:name    notes of the model
+//	card:name    cards of the template, or card:2 for the second card
+//	is:state     new, learn, review, suspended or buried cards
+//	flag:n       cards with the flag; flag:0 for none
+//	re:regex     notes with a field matching the regular expression
+//	nid:1,2      notes with the given IDs
+//
+// Matching ignores case, and a backslash escapes a wildcard or special
+// character.
+type Search struct {
+	query string
+	root  searchNode
+}
+
+// ParseSearch parses a query in Anki's search syntax. An empty query matches
+// every card.
+func ParseSearch(query string) (*Search, error) {
+	tokens, err := tokenizeSearch(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search %q: %v", query, err)
+	}
+
+	search := &Search{query: query, root: searchAll{}}
+	if len(tokens) == 0 {
+		return search, nil
+	}
+
+	parser := &searchParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err == nil && parser.pos < len(tokens) {
+		err = fmt.Errorf("unexpected )")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid search %q: %v", query, err)
+	}
+	search.root = root
+	return search, nil
+}
+
+// String returns the query the search was parsed from
+func (s *Search) String() string {
+	return s.query
+}
+
+// FindNotes returns the package's notes with a card matching an Anki search,
+// in deck order
+func (p *Package) FindNotes(query string) ([]*Note, error) {
+	cards, err := p.findCards(query)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]*Note, 0)
+	seen := make(map[*Note]bool)
+	for _, card := range cards {
+		if !seen[card.note] {
+			seen[card.note] = true
+			notes = append(notes, card.note)
+		}
+	}
+	return notes, nil
+}
+
+// FindCards returns the cards the package's notes will have that match an
+// Anki search, in deck order. The cards have no ID until the package is
+// written.
+func (p *Package) FindCards(query string) ([]*Card, error) {
+	matches, err := p.findCards(query)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make([]*Card, len(matches))
+	for i, match := range matches {
+		cards[i] = &Card{
+			NoteID:       match.note.ID,
+			DeckID:       match.deckID,
+			Ord:          match.ord,
+			Modified:     match.note.Modified,
+			CardSchedule: *match.schedule,
+		}
+	}
+	return cards, nil
+}
+
+func (p *Package) findCards(query string) ([]*searchCard, error) {
+	search, err := ParseSearch(query)
+	if err != nil {
+		return nil, err
+	}
+
+	modelsByID := make(map[int64]*Model, len(p.models))
+	for _, model := range p.models {
+		modelsByID[model.ID] = model
+	}
+
+	decks := flattenDecks(p.decks)
+	deckNames := make(map[int64]string, len(decks))
+	for _, deck := range decks {
+		deckName, err := NormalizeDeckName(deck.Name)
+		if err != nil {
+			return nil, err
+		}
+		deckNames[deck.ID] = deckName
+	}
+
+	matches := make([]*searchCard, 0)
+	for _, deck := range decks {
+		for _, note := range deck.Notes {
+			model, ok := modelsByID[note.ModelID]
+			if !ok {
+				return nil, fmt.Errorf("note %d references unknown model %d", note.ID, note.ModelID)
+			}
+			ords, err := cardOrdinals(model, note)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate cards: %v", err)
+			}
+
+			for _, ord := range ords {
+				schedule := note.cardState(ord, 0)
+				deckID := deck.ID
+				if schedule.DeckID != 0 {
+					deckID = schedule.DeckID
+				}
+				card := &searchCard{
+					note:     note,
+					model:    model,
+					deckID:   deckID,
+					deckName: deckNames[deckID],
+					ord:      ord,
+					schedule: schedule,
+				}
+				if search.root.matches(card) {
+					matches = append(matches, card)
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+// FindNotes returns the collection's notes with a card matching an Anki
+// search, in ID order
+func (d *Database) FindNotes(query string) ([]*Note, error) {
+	expr, args, err := d.compileSearch(query)
+	if err != nil {
+		return nil, err
+	}
+	return queryNotes(d.db, "WHERE id IN (SELECT c.nid FROM cards c JOIN notes n ON n.id = c.nid WHERE "+expr+")", args...)
+}
+
+// FindCards returns the collection's cards matching an Anki search, ordered
+// by note and ordinal
+func (d *Database) FindCards(query string) ([]*Card, error) {
+	expr, args, err := d.compileSearch(query)
+	if err != nil {
+		return nil, err
+	}
+	return d.cards("WHERE id IN (SELECT c.id FROM cards c JOIN notes n ON n.id = c.nid WHERE "+expr+")", args...)
+}
+
+// compileSearch compiles a search into an SQL expression over cards c joined
+// with notes n, resolving deck and model names against the collection
+func (d *Database) compileSearch(query string) (string, []interface{}, error) {
+	search, err := ParseSearch(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	models, err := d.Models()
+	if err != nil {
+		return "", nil, err
+	}
+	decks, filtered, err := d.readDecks()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ctx := &searchContext{models: models, decks: make(map[int64]string, len(decks)+len(filtered))}
+	for _, deck := range decks {
+		ctx.decks[deck.ID] = deck.Name
+	}
+	for _, deck := range filtered {
+		ctx.decks[deck.ID] = deck.Name
+	}
+
+	expr := search.root.sql(ctx)
+	return expr, ctx.args, nil
+}
+
+// searchCard is a card of a package note being matched against a search
+type searchCard struct {
+	note     *Note
+	model    *Model
+	deckID   int64
+	deckName string
+	ord      int
+	schedule *CardSchedule
+}
+
+// searchContext collects the arguments of a search compiled to SQL
+type searchContext struct {
+	models []*Model
+	decks  map[int64]string
+	args   []interface{}
+}
+
+func (ctx *searchContext) arg(value interface{}) string {
+	ctx.args = append(ctx.args, value)
+	return "?"
+}
+
+// deckIDs returns the IDs of the decks whose names match re, in ID order
+func (ctx *searchContext) deckIDs(re *regexp.Regexp) []int64 {
+	ids := make([]int64, 0)
+	for id, name := range ctx.decks {
+		if re.MatchString(name) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// searchNode is a term or operator of a parsed search
+type searchNode interface {
+	matches(card *searchCard) bool
+	sql(ctx *searchContext) string
+}
+
+type searchAll struct{}
+
+func (searchAll) matches(*searchCard) bool { return true }
+
+func (searchAll) sql(*searchContext) string { return "1" }
+
+type searchAnd []searchNode
+
+func (n searchAnd) matches(card *searchCard) bool {
+	for _, child := range n {
+		if !child.matches(card) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n searchAnd) sql(ctx *searchContext) string {
+	return joinSearchSQL(n, " AND ", ctx)
+}
+
+type searchOr []searchNode
+
+func (n searchOr) matches(card *searchCard) bool {
+	for _, child := range n {
+		if child.matches(card) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n searchOr) sql(ctx *searchContext) string {
+	return joinSearchSQL(n, " OR ", ctx)
+}
+
+type searchNot struct {
+	child searchNode
+}
+
+func (n searchNot) matches(card *searchCard) bool {
+	return !n.child.matches(card)
+}
+
+func (n searchNot) sql(ctx *searchContext) string {
+	return "NOT " + n.child.sql(ctx)
+}
+
+// searchText matches the note's fields joined with 0x1f, as stored in notes.flds
+type searchText struct {
+	re *regexp.Regexp
+}
+
+func (n searchText) matches(card *searchCard) bool {
+	return n.re.MatchString(strings.Join(card.note.Fields, "\x1f"))
+}
+
+func (n searchText) sql(ctx *searchContext) string {
+	return "n.flds REGEXP " + ctx.arg(n.re.String())
+}
+
+type searchField struct {
+	name  *regexp.Regexp
+	value *regexp.Regexp
+}
+
+func (n searchField) matches(card *searchCard) bool {
+	for i, field := range card.model.Fields {
+		if i < len(card.note.Fields) && n.name.MatchString(field.Name) && n.value.MatchString(card.note.Fields[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n searchField) sql(ctx *searchContext) string {
+	conditions := make([]string, 0)
+	for _, model := range ctx.models {
+		for i, field := range model.Fields {
+			if n.name.MatchString(field.Name) {
+				conditions = append(conditions, fmt.Sprintf("(n.mid = %d AND field_at(n.flds, %d) REGEXP %s)", model.ID, i, ctx.arg(n.value.String())))
+			}
+		}
+	}
+	return orSQL(conditions)
+}
+
+// searchTag matches single tags with re, or the space-separated notes.tags
+// column with column
+type searchTag struct {
+	re     *regexp.Regexp
+	column *regexp.Regexp
+	none   bool
+}
+
+func (n searchTag) matches(card *searchCard) bool {
+	if n.none {
+		return len(card.note.Tags) == 0
+	}
+	for _, tag := range card.note.Tags {
+		if n.re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n searchTag) sql(ctx *searchContext) string {
+	if n.none {
+		return "trim(n.tags) = ''"
+	}
+	return "n.tags REGEXP " + ctx.arg(n.column.String())
+}
+
+type searchDeck struct {
+	re *regexp.Regexp
+}
+
+func (n searchDeck) matches(card *searchCard) bool {
+	return n.re.MatchString(card.deckName)
+}
+
+func (n searchDeck) sql(ctx *searchContext) string {
+	ids := ctx.deckIDs(n.re)
+	if len(ids) == 0 {
+		return "0"
+	}
+	list := joinIDs(ids)
+	return fmt.Sprintf("(c.did IN (%s) OR c.odid IN (%s))", list, list)
+}
+
+type searchNotetype struct {
+	re *regexp.Regexp
+}
+
+func (n searchNotetype) matches(card *searchCard) bool {
+	return n.re.MatchString(card.model.Name)
+}
+
+func (n searchNotetype) sql(ctx *searchContext) string {
+	ids := make([]int64, 0)
+	for _, model := range ctx.models {
+		if n.re.MatchString(model.Name) {
+			ids = append(ids, model.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("n.mid IN (%s)", joinIDs(ids))
+}
+
+// searchTemplate matches cards by template name, or by ordinal if name is nil
+type searchTemplate struct {
+	ord  int
+	name *regexp.Regexp
+}
+
+func (n searchTemplate) matches(card *searchCard) bool {
+	if n.name == nil {
+		return card.ord == n.ord
+	}
+	ords, all := n.templateOrds(card.model)
+	if all {
+		return true
+	}
+	for _, ord := range ords {
+		if ord == card.ord {
+			return true
+		}
+	}
+	return false
+}
+
+func (n searchTemplate) sql(ctx *searchContext) string {
+	if n.name == nil {
+		return fmt.Sprintf("c.ord = %d", n.ord)
+	}
+
+	conditions := make([]string, 0)
+	for _, model := range ctx.models {
+		ords, all := n.templateOrds(model)
+		if all {
+			conditions = append(conditions, fmt.Sprintf("n.mid = %d", model.ID))
+		} else if len(ords) > 0 {
+			conditions = append(conditions, fmt.Sprintf("(n.mid = %d AND c.ord IN (%s))", model.ID, joinInts(ords)))
+		}
+	}
+	return orSQL(conditions)
+}
+
+// templateOrds returns the ordinals of the model's templates matching the
+// name. A cloze model's single template stands for all of its cards.
+func (n searchTemplate) templateOrds(model *Model) ([]int, bool) {
+	ords := make([]int, 0)
+	for _, template := range model.Templates {
+		if n.name.MatchString(template.Name) {
+			if getModelType(model) == 1 {
+				return nil, true
+			}
+			ords = append(ords, template.Ord)
+		}
+	}
+	return ords, false
+}
+
+type searchState struct {
+	state string
+}
+
+func (n searchState) matches(card *searchCard) bool {
+	cardType, queue := card.schedule.Type, card.schedule.queue()
+	switch n.state {
+	case "new":
+		return cardType == CardTypeNew
+	case "learn":
+		return cardType == CardTypeLearning || cardType == CardTypeRelearning
+	case "review":
+		return cardType == CardTypeReview || cardType == CardTypeRelearning
+	case "suspended":
+		return queue == QueueSuspended
+	case "buried":
+		return queue == QueueBuried || queue == QueueUserBuried
+	}
+	return false
+}
+
+func (n searchState) sql(*searchContext) string {
+	switch n.state {
+	case "new":
+		return fmt.Sprintf("c.type = %d", CardTypeNew)
+	case "learn":
+		return fmt.Sprintf("c.type IN (%d, %d)", CardTypeLearning, CardTypeRelearning)
+	case "review":
+		return fmt.Sprintf("c.type IN (%d, %d)", CardTypeReview, CardTypeRelearning)
+	case "suspended":
+		return fmt.Sprintf("c.queue = %d", QueueSuspended)
+	case "buried":
+		return fmt.Sprintf("c.queue IN (%d, %d)", QueueBuried, QueueUserBuried)
+	}
+	return "0"
+}
+
+type searchFlag struct {
+	flag CardFlag
+}
+
+func (n searchFlag) matches(card *searchCard) bool {
+	return card.schedule.Flag == n.flag
+}
+
+func (n searchFlag) sql(*searchContext) string {
+	return fmt.Sprintf("(c.flags & 7) = %d", n.flag)
+}
+
+type searchNoteIDs struct {
+	ids []int64
+}
+
+func (n searchNoteIDs) matches(card *searchCard) bool {
+	for _, id := range n.ids {
+		if card.note.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (n searchNoteIDs) sql(*searchContext) string {
+	return fmt.Sprintf("n.id IN (%s)", joinIDs(n.ids))
+}
+
+func joinSearchSQL(nodes []searchNode, operator string, ctx *searchContext) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.sql(ctx)
+	}
+	return "(" + strings.Join(parts, operator) + ")"
+}
+
+// orSQL joins alternative conditions, matching nothing if there are none
+func orSQL(conditions []string) string {
+	if len(conditions) == 0 {
+		return "0"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type searchTokenKind int
+
+const (
+	tokenText searchTokenKind = iota
+	tokenNegate
+	tokenOpen
+	tokenClose
+)
+
+// searchToken is a lexed search token. Text keeps its backslash escapes, so
+// wildcards can be told apart from escaped characters later.
+type searchToken struct {
+	kind   searchTokenKind
+	text   string
+	quoted bool
+}
+
+func tokenizeSearch(query string) ([]searchToken, error) {
+	tokens := make([]searchToken, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, searchToken{kind: tokenOpen})
+			i++
+		case r == ')':
+			tokens = append(tokens, searchToken{kind: tokenClose})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, searchToken{kind: tokenNegate})
+			i++
+		default:
+			var text strings.Builder
+			quoted, inQuote := false, false
+			for ; i < len(runes); i++ {
+				r := runes[i]
+				if r == '\\' && i+1 < len(runes) {
+					text.WriteRune(r)
+					text.WriteRune(runes[i+1])
+					i++
+					continue
+				}
+				if r == '"' {
+					quoted, inQuote = true, !inQuote
+					continue
+				}
+				if !inQuote && (unicode.IsSpace(r) || r == '(' || r == ')') {
+					break
+				}
+				text.WriteRune(r)
+			}
+			if inQuote {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			tokens = append(tokens, searchToken{kind: tokenText, text: text.String(), quoted: quoted})
+		}
+	}
+	return tokens, nil
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+// isOperator reports whether the next token is the unquoted keyword
+func (p *searchParser) isOperator(keyword string) bool {
+	if p.pos >= len(p.tokens) {
+		return false
+	}
+	token := p.tokens[p.pos]
+	return token.kind == tokenText && !token.quoted && strings.EqualFold(token.text, keyword)
+}
+
+func (p *searchParser) parseOr() (searchNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := searchOr{first}
+	for p.isOperator("or") {
+		p.pos++
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, next)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+func (p *searchParser) parseAnd() (searchNode, error) {
+	nodes := searchAnd{}
+	for p.pos < len(p.tokens) && p.tokens[p.pos].kind != tokenClose && !p.isOperator("or") {
+		if p.isOperator("and") {
+			p.pos++
+			if len(nodes) == 0 || p.pos >= len(p.tokens) || p.tokens[p.pos].kind == tokenClose || p.isOperator("or") {
+				return nil, fmt.Errorf("misplaced AND")
+			}
+			continue
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, fmt.Errorf("expected a search term")
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *searchParser) parseUnary() (searchNode, error) {
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case tokenNegate:
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind == tokenClose {
+			return nil, fmt.Errorf("expected a search term after -")
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return searchNot{child: child}, nil
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenClose {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	case tokenClose:
+		return nil, fmt.Errorf("unexpected )")
+	}
+	return parseSearchTerm(token.text)
+}
+
+// unsupportedSearches are Anki search keys that need collection history or
+// review state this package does not model
+var unsupportedSearches = map[string]bool{
+	"added": true, "edited": true, "rated": true, "introduced": true, "resched": true,
+	"prop": true, "dupe": true, "preset": true, "cid": true, "mid": true, "did": true,
+}
+
+// parseSearchTerm parses a single term, which is plain text unless it has a
+// "key:" prefix
+func parseSearchTerm(raw string) (searchNode, error) {
+	colon := unescapedIndex(raw, ':')
+	if colon <= 0 {
+		re, err := globRegexp(raw, ".*", ".", "(?is)", "")
+		if err != nil {
+			return nil, err
+		}
+		return searchText{re: re}, nil
+	}
+
+	key := unescapeSearch(raw[:colon])
+	value := raw[colon+1:]
+	lowerKey := strings.ToLower(key)
+	if unsupportedSearches[lowerKey] {
+		return nil, fmt.Errorf("%s: searches are not supported", lowerKey)
+	}
+
+	switch lowerKey {
+	case "deck", "tag", "note", "card", "is", "flag", "re", "nid":
+		if value == "" {
+			return nil, fmt.Errorf("%s: needs a value", lowerKey)
+		}
+	}
+
+	switch lowerKey {
+	case "deck":
+		re, err := globRegexp(value, ".*", ".", "(?is)^", "(::.*)?$")
+		if err != nil {
+			return nil, err
+		}
+		return searchDeck{re: re}, nil
+	case "tag":
+		if strings.EqualFold(value, "none") {
+			return searchTag{none: true}, nil
+		}
+		re, err := globRegexp(value, `\S*`, `\S`, "(?i)^", `(::\S*)?$`)
+		if err != nil {
+			return nil, err
+		}
+		column, err := globRegexp(value, `\S*`, `\S`, `(?i)(^|\s)`, `(::\S*)?(\s|$)`)
+		if err != nil {
+			return nil, err
+		}
+		return searchTag{re: re, column: column}, nil
+	case "note":
+		re, err := globRegexp(value, ".*", ".", "(?is)^", "$")
+		if err != nil {
+			return nil, err
+		}
+		return searchNotetype{re: re}, nil
+	case "card":
+		if n, err := strconv.Atoi(value); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("card: numbers start at 1, got %d", n)
+			}
+			return searchTemplate{ord: n - 1}, nil
+		}
+		re, err := globRegexp(value, ".*", ".", "(?is)^", "$")
+		if err != nil {
+			return nil, err
+		}
+		return searchTemplate{name: re}, nil
+	case "is":
+		state := strings.ToLower(unescapeSearch(value))
+		switch state {
+		case "new", "learn", "review", "suspended", "buried":
+			return searchState{state: state}, nil
+		}
+		return nil, fmt.Errorf("is:%s is not supported", state)
+	case "flag":
+		flag, err := strconv.Atoi(value)
+		if err != nil || flag < int(FlagNone) || flag > int(FlagPurple) {
+			return nil, fmt.Errorf("flag: must be between %d and %d, got %q", FlagNone, FlagPurple, value)
+		}
+		return searchFlag{flag: CardFlag(flag)}, nil
+	case "re":
+		re, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+		return searchText{re: re}, nil
+	case "nid":
+		ids := make([]int64, 0)
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("nid: invalid note ID %q", part)
+			}
+			ids = append(ids, id)
+		}
+		return searchNoteIDs{ids: ids}, nil
+	}
+
+	// Any other key names a field
+	name, err := globRegexp(raw[:colon], ".*", ".", "(?is)^", "$")
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.ToLower(value), "re:") {
+		re, err := regexp.Compile("(?i)" + value[len("re:"):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value[len("re:"):], err)
+		}
+		return searchField{name: name, value: re}, nil
+	}
+	re, err := globRegexp(value, ".*", ".", "(?is)^", "$")
+	if err != nil {
+		return nil, err
+	}
+	return searchField{name: name, value: re}, nil
+}
+
+// globRegexp compiles a search pattern into a regular expression between
+// prefix and suffix, with * and _ matching any and one character and escaped
+// characters matching themselves
+func globRegexp(pattern, anyChars, oneChar, prefix, suffix string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString(prefix)
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '*':
+			expr.WriteString(anyChars)
+		case r == '_':
+			expr.WriteString(oneChar)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString(suffix)
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// unescapedIndex returns the index of the first c in s not escaped with a
+// backslash, or -1
+func unescapedIndex(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeSearch removes the backslash escapes from search text
+func unescapeSearch(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
@@ -0,0 +1,74 @@
+package genanki
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the SQLite driver with the functions and collations Anki
+// registers on its own connections
+const sqliteDriver = "sqlite3_genanki"
+
+// maxSQLiteRegexps bounds the regexp cache; a search only uses a few patterns
+const maxSQLiteRegexps = 64
+
+// sqliteRegexps caches the patterns compiled by the regexp function, which
+// runs once per row. It is emptied when full so that a long-running process
+// doesn't keep every pattern it ever searched for.
+var sqliteRegexps = struct {
+	sync.Mutex
+	cache map[string]*regexp.Regexp
+}{cache: make(map[string]*regexp.Regexp)}
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// Schema 18 tables compare names case-insensitively
+			err := conn.RegisterCollation("unicase", func(a, b string) int {
+				return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+			})
+			if err != nil {
+				return err
+			}
+
+			// Searches compile to "value REGEXP pattern" and field_at(flds, ord)
+			if err := conn.RegisterFunc("regexp", sqliteRegexp, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("field_at", sqliteFieldAt, true)
+		},
+	})
+}
+
+func sqliteRegexp(pattern, value string) (bool, error) {
+	sqliteRegexps.Lock()
+	re, ok := sqliteRegexps.cache[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			sqliteRegexps.Unlock()
+			return false, err
+		}
+		if len(sqliteRegexps.cache) >= maxSQLiteRegexps {
+			sqliteRegexps.cache = make(map[string]*regexp.Regexp)
+		}
+		sqliteRegexps.cache[pattern] = re
+	}
+	sqliteRegexps.Unlock()
+
+	return re.MatchString(value), nil
+}
+
+// sqliteFieldAt returns the field at index ord of a notes.flds value, or an
+// empty string if the note has fewer fields
+func sqliteFieldAt(flds string, ord int) string {
+	fields := strings.Split(flds, "\x1f")
+	if ord < 0 || ord >= len(fields) {
+		return ""
+	}
+	return fields[ord]
+}
@@ -0,0 +1,144 @@
+package genanki
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// structTag is the struct tag read by ModelFromStruct and NotesFromStructs.
+// `anki:"Word"` maps a string field to the model field "Word", `anki:",tags"`
+// marks a []string field holding the note's tags and `anki:"-"` skips a field.
+const structTag = "anki"
+
+// structMapping describes how a struct type maps onto model fields
+type structMapping struct {
+	fieldNames []string
+	fieldIndex [][]int // reflect field index per model field
+	tagsIndex  []int   // reflect field index of the tags field, if any
+}
+
+// ModelFromStruct derives a model from the `anki` tags of T. Fields appear in
+// declaration order, the model gets a single card showing the first field on
+// the front and the others on the back, and its ID is derived from the name and
+// field names so rebuilding a deck keeps the same model.
+func ModelFromStruct[T any](name string) (*Model, error) {
+	mapping, err := mappingFor(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	model := NewModel(deriveID(append([]string{"model", name}, mapping.fieldNames...)...), name)
+	for _, fieldName := range mapping.fieldNames {
+		model.AddField(Field{Name: fieldName, Font: "Arial", Size: 20, Color: "#000000", Align: "left"})
+	}
+
+	back := make([]string, 0, len(mapping.fieldNames)-1)
+	for _, fieldName := range mapping.fieldNames[1:] {
+		back = append(back, "{{"+fieldName+"}}")
+	}
+	model.AddTemplate(Template{
+		Name: "Card 1",
+		Qfmt: "{{" + mapping.fieldNames[0] + "}}",
+		Afmt: "{{FrontSide}}\n\n<hr id=answer>\n\n" + strings.Join(back, "<br>\n"),
+	})
+
+	return model, nil
+}
+
+// NotesFromStructs converts items into notes of model, matching struct fields
+// to model fields by their `anki` tag names.
+func NotesFromStructs[T any](model *Model, items []T) ([]*Note, error) {
+	mapping, err := mappingFor(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]*Note, 0, len(items))
+	for i, item := range items {
+		v := reflect.ValueOf(item)
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil, fmt.Errorf("item %d is nil", i)
+			}
+			v = v.Elem()
+		}
+
+		// Fields promoted through a nil embedded pointer are left empty
+		values := make(map[string]string, len(mapping.fieldNames))
+		for j, fieldName := range mapping.fieldNames {
+			if field, err := v.FieldByIndexErr(mapping.fieldIndex[j]); err == nil {
+				values[fieldName] = field.String()
+			}
+		}
+
+		var tags []string
+		if mapping.tagsIndex != nil {
+			if field, err := v.FieldByIndexErr(mapping.tagsIndex); err == nil {
+				tags = append(tags, field.Interface().([]string)...)
+			}
+		}
+
+		note, err := NewNoteFromMap(model, values, tags)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+func mappingFor(t reflect.Type) (*structMapping, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+
+	mapping := &structMapping{}
+	seen := make(map[string]bool)
+
+	for _, sf := range reflect.VisibleFields(t) {
+		tag, ok := sf.Tag.Lookup(structTag)
+		if !ok || tag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		name, option, _ := strings.Cut(tag, ",")
+		if option == "tags" {
+			if sf.Type != reflect.TypeOf([]string(nil)) {
+				return nil, fmt.Errorf("tags field %s.%s must be a []string", t.Name(), sf.Name)
+			}
+			if mapping.tagsIndex != nil {
+				return nil, fmt.Errorf("%s has more than one tags field", t.Name())
+			}
+			mapping.tagsIndex = sf.Index
+			continue
+		}
+		if option != "" {
+			return nil, fmt.Errorf("unknown %s tag option %q on %s.%s", structTag, option, t.Name(), sf.Name)
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		if sf.Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("field %s.%s must be a string", t.Name(), sf.Name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s maps more than one field to %q", t.Name(), name)
+		}
+		seen[name] = true
+
+		mapping.fieldNames = append(mapping.fieldNames, name)
+		mapping.fieldIndex = append(mapping.fieldIndex, sf.Index)
+	}
+
+	if len(mapping.fieldNames) == 0 {
+		return nil, fmt.Errorf("%s has no fields tagged with %q", t.Name(), structTag)
+	}
+
+	return mapping, nil
+}
@@ -0,0 +1,137 @@
+package genanki
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type templateNodeKind int
+
+const (
+	textNode templateNodeKind = iota
+	replacementNode
+	conditionalNode
+	negatedConditionalNode
+)
+
+// templateNode is one element of a parsed card template. Replacements keep
+// their filters in application order, so "text:cloze:Text" becomes key "Text"
+// with filters ["cloze", "text"].
+type templateNode struct {
+	kind     templateNodeKind
+	text     string
+	key      string
+	filters  []string
+	children []templateNode
+}
+
+// parseTemplate parses an Anki card template into a tree of nodes
+func parseTemplate(src string) ([]templateNode, error) {
+	nodes, rest, closing, err := parseTemplateNodes(src)
+	if err != nil {
+		return nil, err
+	}
+	if closing != "" {
+		return nil, fmt.Errorf("found {{/%s}} without a matching opening tag", closing)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected trailing template text %q", rest)
+	}
+	return nodes, nil
+}
+
+// parseTemplateNodes parses until the end of src or a closing tag, returning
+// the parsed nodes, the unparsed remainder and the key of the closing tag.
+func parseTemplateNodes(src string) ([]templateNode, string, string, error) {
+	nodes := make([]templateNode, 0)
+
+	for src != "" {
+		start := strings.Index(src, "{{")
+		if start < 0 {
+			nodes = append(nodes, templateNode{kind: textNode, text: src})
+			break
+		}
+		if start > 0 {
+			nodes = append(nodes, templateNode{kind: textNode, text: src[:start]})
+		}
+
+		end := strings.Index(src[start:], "}}")
+		if end < 0 {
+			return nil, "", "", fmt.Errorf("unterminated tag %q", src[start:])
+		}
+		tag := strings.TrimSpace(src[start+2 : start+end])
+		src = src[start+end+2:]
+
+		switch {
+		case strings.HasPrefix(tag, "/"):
+			return nodes, src, strings.TrimSpace(tag[1:]), nil
+		case strings.HasPrefix(tag, "#"), strings.HasPrefix(tag, "^"):
+			key := strings.TrimSpace(tag[1:])
+			children, rest, closing, err := parseTemplateNodes(src)
+			if err != nil {
+				return nil, "", "", err
+			}
+			if closing != key {
+				return nil, "", "", fmt.Errorf("conditional {{%s}} is not closed by {{/%s}}", tag, key)
+			}
+			kind := conditionalNode
+			if tag[0] == '^' {
+				kind = negatedConditionalNode
+			}
+			nodes = append(nodes, templateNode{kind: kind, key: key, children: children})
+			src = rest
+		default:
+			parts := strings.Split(tag, ":")
+			filters := make([]string, 0, len(parts)-1)
+			for i := len(parts) - 2; i >= 0; i-- {
+				filters = append(filters, strings.TrimSpace(parts[i]))
+			}
+			nodes = append(nodes, templateNode{
+				kind:    replacementNode,
+				key:     strings.TrimSpace(parts[len(parts)-1]),
+				filters: filters,
+			})
+		}
+	}
+
+	return nodes, "", "", nil
+}
+
+// templateIsEmpty reports whether nodes would render without any field
+// content when only the fields in nonempty have a value. This mirrors Anki's
+// empty-card rule: static text never makes a card non-empty.
+func templateIsEmpty(nodes []templateNode, nonempty map[string]bool, checkNegated bool) bool {
+	for _, node := range nodes {
+		switch node.kind {
+		case replacementNode:
+			if nonempty[node.key] {
+				return false
+			}
+		case conditionalNode:
+			if nonempty[node.key] && !templateIsEmpty(node.children, nonempty, checkNegated) {
+				return false
+			}
+		case negatedConditionalNode:
+			if checkNegated && !templateIsEmpty(node.children, nonempty, checkNegated) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// emptyFieldRegexp matches field content Anki considers empty: whitespace and
+// stray <br>/<div> tags left behind by the editor.
+var emptyFieldRegexp = regexp.MustCompile(`(?si)^(?:\s|</?(?:br|div) ?/?>)*$`)
+
+// nonemptyFields returns the names of the model fields that have content in note
+func nonemptyFields(model *Model, note *Note) map[string]bool {
+	nonempty := make(map[string]bool)
+	for i, field := range model.Fields {
+		if i < len(note.Fields) && !emptyFieldRegexp.MatchString(note.Fields[i]) {
+			nonempty[field.Name] = true
+		}
+	}
+	return nonempty
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+type cardRow struct {
+	queue int
+	flags int
+	data  string
+}
+
+func cardRowsFromAPKG(t *testing.T, apkgPath string, noteID int64) map[int]cardRow {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, apkgPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT ord, queue, flags, data FROM cards WHERE nid = ?", noteID)
+	if err != nil {
+		t.Fatalf("query cards: %v", err)
+	}
+	defer rows.Close()
+
+	cards := make(map[int]cardRow)
+	for rows.Next() {
+		var ord int
+		var row cardRow
+		if err := rows.Scan(&ord, &row.queue, &row.flags, &row.data); err != nil {
+			t.Fatalf("scan card: %v", err)
+		}
+		cards[ord] = row
+	}
+	return cards
+}
+
+// cardCustomData decodes the custom data of cards.data, which Anki stores as a
+// JSON string under "cd"
+func cardCustomData(t *testing.T, data string) map[string]string {
+	t.Helper()
+
+	var card map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &card); err != nil {
+		t.Fatalf("decode card data %q: %v", data, err)
+	}
+	encoded, ok := card["cd"].(string)
+	if !ok {
+		t.Fatalf("Expected cd to be a JSON string, got %q", data)
+	}
+	var customData map[string]string
+	if err := json.Unmarshal([]byte(encoded), &customData); err != nil {
+		t.Fatalf("decode custom data %q: %v", encoded, err)
+	}
+	return customData
+}
+
+func TestSuspendedBuriedAndFlaggedCards(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "State Model")
+	model.AddTemplate(genanki.Template{Name: "Reverse", Qfmt: "{{Back}}", Afmt: "{{Front}}"})
+	deck := genanki.NewDeck(9876543210, "State", "")
+
+	advanced := genanki.NewNote(model.ID, []string{"Subjunctive", "Mood"}, nil).
+		Suspend().
+		SetFlag(genanki.FlagRed).
+		SetCustomData("lvl", "3")
+	partial := genanki.NewNote(model.ID, []string{"Gato", "Cat"}, nil).
+		Bury(1).
+		SetFlag(genanki.FlagBlue, 0).
+		SetCustomData("src", "old", 1)
+	review := genanki.NewNote(model.ID, []string{"Perro", "Dog"}, nil).
+		SetSchedule(0, &genanki.CardSchedule{Type: genanki.CardTypeReview, Due: time.Now().AddDate(0, 0, 3), Interval: 5}).
+		Suspend()
+
+	deck.AddNote(advanced).AddNote(partial).AddNote(review)
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	cards := cardRowsFromAPKG(t, tmpPath, advanced.ID)
+	for ord := 0; ord < 2; ord++ {
+		card := cards[ord]
+		if card.queue != -1 || card.flags != 1 {
+			t.Errorf("Expected card %d suspended with a red flag, got %+v", ord, card)
+		}
+		if data := cardCustomData(t, card.data); data["lvl"] != "3" {
+			t.Errorf("Expected custom data lvl=3 on card %d, got %q", ord, card.data)
+		}
+	}
+
+	cards = cardRowsFromAPKG(t, tmpPath, partial.ID)
+	if cards[0].queue != 0 || cards[0].flags != 4 || cards[0].data != "{}" {
+		t.Errorf("Expected card 0 new with a blue flag, got %+v", cards[0])
+	}
+	if cards[1].queue != -2 || cards[1].flags != 0 || cards[1].data != `{"cd":"{\"src\":\"old\"}"}` {
+		t.Errorf("Expected card 1 buried with custom data, got %+v", cards[1])
+	}
+
+	cards = cardRowsFromAPKG(t, tmpPath, review.ID)
+	if cards[0].queue != -1 || cards[1].queue != -1 {
+		t.Errorf("Expected every card of the suspended note to be suspended, got %+v", cards)
+	}
+}
+
+func TestDeckCardState(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "State Model")
+	buried := genanki.NewDeck(9876543210, "Buried", "")
+	suspended := genanki.NewDeck(1111111111, "Suspended", "")
+
+	gato := genanki.NewNote(model.ID, []string{"Gato", "Cat"}, nil)
+	perro := genanki.NewNote(model.ID, []string{"Perro", "Dog"}, nil)
+	casa := genanki.NewNote(model.ID, []string{"Casa", "House"}, nil)
+	buried.AddNote(gato).AddNote(perro).Bury().SetFlag(genanki.FlagGreen)
+	suspended.AddNote(casa).Suspend().SetCustomData("src", "deck")
+
+	pkg := genanki.NewPackage([]*genanki.Deck{buried, suspended}).AddModel(model.Model)
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	for _, note := range []*genanki.Note{gato, perro} {
+		// The v1 scheduler the collection declares only has the -2 buried queue
+		if card := cardRowsFromAPKG(t, tmpPath, note.ID)[0]; card.queue != -2 || card.flags != 3 {
+			t.Errorf("Expected a user-buried card with a green flag, got %+v", card)
+		}
+	}
+	if card := cardRowsFromAPKG(t, tmpPath, casa.ID)[0]; card.queue != -1 || cardCustomData(t, card.data)["src"] != "deck" {
+		t.Errorf("Expected a suspended card with custom data, got %+v", card)
+	}
+}
+
+func TestInvalidCardStateFailsValidation(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "State Model")
+	deck := genanki.NewDeck(9876543210, "State", "")
+
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Gato", "Cat"}, nil).SetFlag(genanki.CardFlag(9)))
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Perro", "Dog"}, nil).SetCustomData("toolongkey", "x"))
+
+	err := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).Validate()
+
+	var validationErr *genanki.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", validationErr.Problems)
+	}
+	var scheduleErr *genanki.ScheduleError
+	if !errors.As(validationErr.Problems[1], &scheduleErr) {
+		t.Errorf("Expected a ScheduleError, got %v", validationErr.Problems[1])
+	}
+}
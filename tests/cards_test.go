@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCardPerTemplate(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Reverse Model")
+	model.AddTemplate(genanki.Template{
+		Name: "Card 2",
+		Qfmt: "{{Back}}",
+		Afmt: "{{FrontSide}}<hr id=answer>{{Front}}",
+	})
+
+	deck := genanki.NewDeck(9876543210, "Reverse Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"hola", "hello"}, nil))
+	deck.AddNote(genanki.NewNote(model.ID, []string{"adiós", ""}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+	ords := cardOrdsFromPackage(t, pkg)
+
+	if len(ords) != 2 || ords[0] != 2 || ords[1] != 1 {
+		t.Errorf("Expected two cards with ord 0 and one with ord 1, got %v", ords)
+	}
+}
+
+func TestConditionalTemplateSkipsEmptyCard(t *testing.T) {
+	model := genanki.NewModel(1234567890, "Conditional Model")
+	model.AddField(genanki.Field{Name: "Word"}).
+		AddField(genanki.Field{Name: "Audio"}).
+		AddTemplate(genanki.Template{Name: "Read", Qfmt: "{{Word}}", Afmt: "{{FrontSide}}"}).
+		AddTemplate(genanki.Template{Name: "Listen", Qfmt: "Listen: {{#Audio}}{{Audio}}{{/Audio}}", Afmt: "{{Word}}"})
+
+	deck := genanki.NewDeck(9876543210, "Conditional Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"gato", ""}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model)
+	ords := cardOrdsFromPackage(t, pkg)
+
+	if len(ords) != 1 || ords[0] != 1 {
+		t.Errorf("Expected a single card with ord 0, got %v", ords)
+	}
+}
+
+func TestNoteWithoutCardsFails(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Empty Model")
+	deck := genanki.NewDeck(9876543210, "Empty Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"", "Back only"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err == nil {
+		t.Fatal("Expected an error for a note that generates no cards")
+	}
+}
+
+func TestClozeCardPerDeletion(t *testing.T) {
+	model := genanki.NewClozeModel(1234567890, "Cloze Model")
+	deck := genanki.NewDeck(9876543210, "Cloze Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{
+		"{{c1::Paris}} is the capital of {{c2::France}}, {{c1::Paris}} again and {{c3::Europe::continent}}",
+		"Extra {{c5::ignored}}",
+	}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+	ords := cardOrdsFromPackage(t, pkg)
+
+	if len(ords) != 3 || ords[0] != 1 || ords[1] != 1 || ords[2] != 1 {
+		t.Errorf("Expected one card each for ords 0, 1 and 2, got %v", ords)
+	}
+}
+
+func TestClozeNoteWithoutDeletionsFails(t *testing.T) {
+	model := genanki.NewClozeModel(1234567890, "Cloze Model")
+	deck := genanki.NewDeck(9876543210, "Cloze Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"No deletions here", ""}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err == nil {
+		t.Fatal("Expected an error for a cloze note without deletions")
+	}
+}
+
+// cardOrdsFromPackage writes pkg and returns the number of cards per ord
+func cardOrdsFromPackage(t *testing.T, pkg *genanki.Package) map[int]int {
+	t.Helper()
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, tmpPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT ord, COUNT(*) FROM cards GROUP BY ord")
+	if err != nil {
+		t.Fatalf("query cards: %v", err)
+	}
+	defer rows.Close()
+
+	ords := make(map[int]int)
+	for rows.Next() {
+		var ord, count int
+		if err := rows.Scan(&ord, &count); err != nil {
+			t.Fatalf("scan card: %v", err)
+		}
+		ords[ord] = count
+	}
+	return ords
+}
+
+func tempPackagePath(t *testing.T) string {
+	t.Helper()
+	return tempFilePath(t, "cards-*.apkg")
+}
+
+// tempCollectionPackagePath returns a .colpkg path, which packages with
+// filtered decks must be written to
+func tempCollectionPackagePath(t *testing.T) string {
+	t.Helper()
+	return tempFilePath(t, "cards-*.colpkg")
+}
+
+func tempFilePath(t *testing.T, pattern string) string {
+	t.Helper()
+
+	tmpFile, err := os.CreateTemp("", pattern)
+	if err != nil {
+		t.Fatalf("create temp file: %v", err)
+	}
+	tmpFile.Close()
+	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
+
+	return tmpFile.Name()
+}
@@ -98,8 +98,8 @@ func TestPackageChaining(t *testing.T) {
 	// Create models and deck
 	basicModel := genanki.StandardBasicModel("Package Chaining Model")
 	clozeModel := genanki.StandardClozeModel("Package Chaining Cloze")
-	deck1 := genanki.StandardDeck("Deck 1", "First test deck")
-	deck2 := genanki.StandardDeck("Deck 2", "Second test deck")
+	deck1 := genanki.NewDeck(1111111111, "Deck 1", "First test deck")
+	deck2 := genanki.NewDeck(2222222222, "Deck 2", "Second test deck")
 
 	// Add notes to decks using chaining
 	note1 := genanki.NewNote(basicModel.ID, []string{"Q1", "A1"}, nil)
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestFileBackedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collection.anki2")
+	model := genanki.NewBasicModel(1234567890, "File Basic")
+	deck := genanki.NewDeck(1111111111, "File Deck", "")
+
+	db, err := genanki.CreateDatabase(path)
+	if err != nil {
+		t.Fatalf("CreateDatabase: %v", err)
+	}
+	if _, err := db.AddModel(model.Model); err != nil {
+		t.Fatalf("AddModel: %v", err)
+	}
+	if _, err := db.AddDeck(deck); err != nil {
+		t.Fatalf("AddDeck: %v", err)
+	}
+	first := genanki.NewNote(model.ID, []string{"First", "Session"}, nil)
+	if _, err := db.AddNote(first); err != nil {
+		t.Fatalf("AddNote: %v", err)
+	}
+	if _, err := db.AddCard(first.ID, deck.ID, 0); err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := genanki.CreateDatabase(path); err == nil {
+		t.Error("Expected CreateDatabase to refuse an existing file")
+	}
+
+	// A later session adds to the same collection
+	db, err = genanki.OpenDatabase(path)
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	defer db.Close()
+
+	second := genanki.NewNote(model.ID, []string{"Second", "Session"}, nil)
+	if _, err := db.AddNote(second); err != nil {
+		t.Fatalf("AddNote: %v", err)
+	}
+	if _, err := db.AddCard(second.ID, deck.ID, 0); err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+
+	tmpPath := tempPackagePath(t)
+	if err := genanki.NewPackage(db).WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	read, err := genanki.OpenPackage(tmpPath)
+	if err != nil {
+		t.Fatalf("OpenPackage: %v", err)
+	}
+	decks := read.GetDecks()
+	if len(decks) != 1 || decks[0].Name != "File Deck" || len(decks[0].Notes) != 2 {
+		t.Fatalf("Expected both sessions' notes in File Deck, got %+v", decks)
+	}
+}
+
+func TestOpenDatabaseErrors(t *testing.T) {
+	if _, err := genanki.OpenDatabase(filepath.Join(t.TempDir(), "missing.anki2")); err == nil {
+		t.Error("Expected OpenDatabase to fail for a missing file")
+	}
+
+	db, err := genanki.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.AddModel(genanki.NewBasicModel(1234567890, "Memory Basic").Model); err != nil {
+		t.Errorf("Expected an in-memory collection to accept models, got %v", err)
+	}
+}
+
+func TestInMemoryDatabaseConcurrentUse(t *testing.T) {
+	db, model, spanish, _ := buildQueryDatabase(t)
+
+	// Every call must see the same in-memory collection, not a fresh one.
+	// Calls only overlap when goroutines run in parallel.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			note := genanki.NewNote(model.ID, []string{fmt.Sprintf("word %d", i), "meaning"}, nil)
+			if _, err := db.AddNote(note); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := db.AddCard(note.ID, spanish.ID, 0); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := db.Notes(nil); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Concurrent use failed: %v", err)
+	}
+
+	notes, err := db.Notes(nil)
+	if err != nil || len(notes) != 32 {
+		t.Errorf("Expected 32 notes, got %d (%v)", len(notes), err)
+	}
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDeckOptionsInCollection(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Options Model")
+
+	intensive := genanki.NewDeckOptions(0, "Intensive")
+	intensive.NewPerDay = 50
+	intensive.LearningSteps = []float64{1, 5, 30}
+	intensive.LeechAction = genanki.LeechSuspend
+	intensive.FSRSParams = make([]float64, 19)
+	intensive.FSRSParams[0] = 0.4
+
+	unused := genanki.NewDeckOptions(424242, "Registered Only")
+
+	deck := genanki.NewDeck(9876543210, "Course", "").SetOptions(intensive)
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Q", "A"}, nil))
+	child := deck.NewSubdeck(0, "Chapter 1", "")
+	child.AddNote(genanki.NewNote(model.ID, []string{"Q1", "A1"}, nil))
+	other := genanki.NewDeck(1111111111, "Other", "")
+	other.AddNote(genanki.NewNote(model.ID, []string{"Q2", "A2"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck, other}).
+		AddModel(model.Model).
+		AddDeckOptions(unused)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, tmpPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	var dconfJSON string
+	if err := db.QueryRow("SELECT dconf FROM col").Scan(&dconfJSON); err != nil {
+		t.Fatalf("query dconf: %v", err)
+	}
+
+	var dconf map[string]struct {
+		Name string `json:"name"`
+		New  struct {
+			PerDay int       `json:"perDay"`
+			Delays []float64 `json:"delays"`
+		} `json:"new"`
+		Lapse struct {
+			LeechAction int `json:"leechAction"`
+		} `json:"lapse"`
+		FSRSParams5 []float64 `json:"fsrsParams5"`
+	}
+	if err := json.Unmarshal([]byte(dconfJSON), &dconf); err != nil {
+		t.Fatalf("unmarshal dconf: %v", err)
+	}
+
+	if len(dconf) != 3 {
+		t.Errorf("Expected Default, Intensive and Registered Only option groups, got %d", len(dconf))
+	}
+	if dconf["1"].Name != "Default" {
+		t.Errorf("Expected the default option group to be kept, got %q", dconf["1"].Name)
+	}
+
+	conf := dconf[strconv.FormatInt(intensive.ID, 10)]
+	if conf.Name != "Intensive" || conf.New.PerDay != 50 || len(conf.New.Delays) != 3 || conf.Lapse.LeechAction != 0 {
+		t.Errorf("Unexpected option group %+v", conf)
+	}
+	if len(conf.FSRSParams5) != 19 || conf.FSRSParams5[0] != 0.4 {
+		t.Errorf("Expected FSRS 5 parameters, got %v", conf.FSRSParams5)
+	}
+
+	decks := collectionDecksFromAPKG(t, tmpPath)
+	if decks[strconv.FormatInt(deck.ID, 10)]["conf"] != float64(intensive.ID) {
+		t.Errorf("Expected deck to use option group %d, got %v", intensive.ID, decks[strconv.FormatInt(deck.ID, 10)]["conf"])
+	}
+	if decks[strconv.FormatInt(child.ID, 10)]["conf"] != float64(intensive.ID) {
+		t.Errorf("Expected subdeck to inherit option group %d, got %v", intensive.ID, decks[strconv.FormatInt(child.ID, 10)]["conf"])
+	}
+	if decks[strconv.FormatInt(other.ID, 10)]["conf"] != float64(1) {
+		t.Errorf("Expected deck without options to use the default group, got %v", decks[strconv.FormatInt(other.ID, 10)]["conf"])
+	}
+}
+
+func TestInvalidDeckOptions(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Options Model")
+
+	opts := genanki.NewDeckOptions(0, "Broken")
+	opts.FSRSParams = []float64{1, 2, 3}
+
+	deck := genanki.NewDeck(9876543210, "Course", "").SetOptions(opts)
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Q", "A"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+	if err := pkg.WriteToFile(tempPackagePath(t)); err == nil {
+		t.Fatal("Expected an error for an invalid number of FSRS parameters")
+	}
+}
+
+func TestDuplicateDeckOptionsIDs(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Options Model")
+
+	relaxed := genanki.NewDeckOptions(555, "Relaxed")
+	intensive := genanki.NewDeckOptions(555, "Intensive")
+	intensive.NewPerDay = 50
+
+	deck := genanki.NewDeck(9876543210, "Course", "").SetOptions(relaxed)
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Q", "A"}, nil))
+	deck.NewSubdeck(0, "Chapter 1", "")
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).AddDeckOptions(intensive)
+	var duplicate *genanki.DuplicateDeckOptionsIDError
+	if err := pkg.Validate(); !errors.As(err, &duplicate) || duplicate.OptionsID != 555 {
+		t.Fatalf("Expected a duplicate deck options ID error, got %v", err)
+	}
+
+	db, err := genanki.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.AddModel(model.Model); err != nil {
+		t.Fatalf("AddModel: %v", err)
+	}
+	if _, err := db.AddDeckOptions(relaxed); err != nil {
+		t.Fatalf("AddDeckOptions: %v", err)
+	}
+	if _, err := db.AddDeckOptions(genanki.NewDeckOptions(555, "Relaxed")); err != nil {
+		t.Errorf("Expected re-adding the same settings to succeed, got %v", err)
+	}
+	if _, err := db.AddDeckOptions(intensive); !errors.As(err, &duplicate) {
+		t.Errorf("Expected a duplicate deck options ID error, got %v", err)
+	}
+}
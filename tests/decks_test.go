@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -85,3 +88,97 @@ func TestAddMedia(t *testing.T) {
 		t.Error("Expected modified time to be updated")
 	}
 }
+
+func TestNormalizeDeckName(t *testing.T) {
+	name, err := genanki.NormalizeDeckName(" Languages :: Spanish::Verbs ")
+	if err != nil {
+		t.Fatalf("normalize deck name: %v", err)
+	}
+	if name != "Languages::Spanish::Verbs" {
+		t.Errorf("Expected trimmed name, got %q", name)
+	}
+
+	for _, invalid := range []string{"", "Languages::", "::Spanish", "Languages:: ::Verbs"} {
+		if _, err := genanki.NormalizeDeckName(invalid); err == nil {
+			t.Errorf("Expected an error for deck name %q", invalid)
+		}
+	}
+}
+
+func TestSubdeckHierarchy(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Hierarchy Model")
+
+	languages := genanki.NewDeck(1111111111, "Languages", "")
+	verbs := languages.NewSubdeck(0, "Spanish::Verbs", "Spanish verbs")
+	verbs.AddNote(genanki.NewNote(model.ID, []string{"hablar", "to speak"}, nil))
+	nouns := genanki.NewDeck(2222222222, "Languages::French::Nouns", "")
+	nouns.AddNote(genanki.NewNote(model.ID, []string{"chat", "cat"}, nil))
+
+	if verbs.Name != "Languages::Spanish::Verbs" {
+		t.Errorf("Expected full subdeck name, got %q", verbs.Name)
+	}
+	if again := genanki.NewDeck(1111111111, "Languages", "").NewSubdeck(0, "Spanish::Verbs", ""); again.ID != verbs.ID {
+		t.Errorf("Expected stable subdeck IDs, got %d and %d", verbs.ID, again.ID)
+	}
+
+	pkg := genanki.NewPackage([]*genanki.Deck{languages, nouns}).AddModel(model.Model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, deck := range collectionDecksFromAPKG(t, tmpPath) {
+		names[deck["name"].(string)] = true
+	}
+
+	for _, name := range []string{
+		"Languages",
+		"Languages::Spanish",
+		"Languages::Spanish::Verbs",
+		"Languages::French",
+		"Languages::French::Nouns",
+	} {
+		if !names[name] {
+			t.Errorf("Expected deck %q in collection, got %v", name, names)
+		}
+	}
+	if len(names) != 5 {
+		t.Errorf("Expected 5 decks, got %v", names)
+	}
+}
+
+func TestInvalidDeckNameFailsValidation(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Invalid Deck Model")
+	deck := genanki.NewDeck(9876543210, "Languages::::Verbs", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"hablar", "to speak"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+
+	var nameErr *genanki.InvalidDeckNameError
+	if err := pkg.Validate(); !errors.As(err, &nameErr) || nameErr.DeckID != deck.ID {
+		t.Errorf("Expected an invalid deck name error, got %v", err)
+	}
+}
+
+func collectionDecksFromAPKG(t *testing.T, apkgPath string) map[string]map[string]interface{} {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, apkgPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	var decksJSON string
+	if err := db.QueryRow("SELECT decks FROM col").Scan(&decksJSON); err != nil {
+		t.Fatalf("query decks: %v", err)
+	}
+
+	var decks map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(decksJSON), &decks); err != nil {
+		t.Fatalf("unmarshal decks: %v", err)
+	}
+	return decks
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestFilteredDeckInCollection(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Filtered Model")
+	deck := genanki.NewDeck(9876543210, "Biology", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Mitochondria", "Powerhouse"}, []string{"exam"}))
+
+	cram := genanki.NewFilteredDeck(0, "Cram::Exam", "tag:exam", 100, genanki.FilteredRandom).
+		AddTerm("is:due", 20, genanki.FilteredOrderDue).
+		SetReschedule(false)
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).
+		AddModel(model.Model).
+		AddFilteredDeck(cram)
+
+	tmpPath := tempCollectionPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	decks := collectionDecksFromAPKG(t, tmpPath)
+
+	filtered := decks[strconv.FormatInt(cram.ID, 10)]
+	if filtered == nil {
+		t.Fatalf("Expected filtered deck %d in collection, got %v", cram.ID, decks)
+	}
+	if filtered["dyn"] != float64(1) || filtered["resched"] != false || filtered["name"] != "Cram::Exam" {
+		t.Errorf("Unexpected filtered deck entry %v", filtered)
+	}
+
+	terms, ok := filtered["terms"].([]interface{})
+	if !ok || len(terms) != 2 {
+		t.Fatalf("Expected 2 search terms, got %v", filtered["terms"])
+	}
+	first := terms[0].([]interface{})
+	if first[0] != "tag:exam" || first[1] != float64(100) || first[2] != float64(1) {
+		t.Errorf("Unexpected first term %v", first)
+	}
+
+	parentFound := false
+	for _, entry := range decks {
+		if entry["name"] == "Cram" && entry["dyn"] == float64(0) {
+			parentFound = true
+		}
+	}
+	if !parentFound {
+		t.Errorf("Expected a regular parent deck for the filtered deck, got %v", decks)
+	}
+}
+
+func TestFilteredDeckNeedsCollectionPackage(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Filtered Model")
+	deck := genanki.NewDeck(9876543210, "Biology", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Q", "A"}, []string{"exam"}))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).
+		AddModel(model.Model).
+		AddFilteredDeck(genanki.NewFilteredDeck(0, "Cram", "tag:exam", 100, genanki.FilteredRandom))
+
+	if err := pkg.WriteToFile(tempPackagePath(t)); err == nil {
+		t.Error("Expected writing filtered decks to an .apkg to fail")
+	}
+}
+
+func TestInvalidFilteredDeck(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Filtered Model")
+	deck := genanki.NewDeck(9876543210, "Biology", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Q", "A"}, nil))
+
+	cram := genanki.NewFilteredDeck(0, "Cram", "tag:exam", 0, genanki.FilteredRandom)
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).AddFilteredDeck(cram)
+
+	var filteredErr *genanki.FilteredDeckError
+	if err := pkg.Validate(); !errors.As(err, &filteredErr) || filteredErr.DeckID != cram.ID {
+		t.Errorf("Expected a filtered deck error, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"database/sql"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestGuidForMatchesPythonGenanki(t *testing.T) {
+	cases := []struct {
+		values   []string
+		expected string
+	}{
+		{[]string{"Capital of France?", "Paris"}, "xlQ`^eZgt3"},
+		{[]string{"日本", "にほん"}, "rY~G!hCgah"},
+		{[]string{"a", "1"}, "r}XH{DW!dU"},
+	}
+
+	for _, c := range cases {
+		if guid := genanki.GuidFor(c.values...); guid != c.expected {
+			t.Errorf("GuidFor(%q) = %q, expected %q", c.values, guid, c.expected)
+		}
+	}
+}
+
+func TestNoteGUIDsInPackage(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "GUID Model")
+	deck := genanki.NewDeck(9876543210, "GUID Deck", "")
+
+	explicit := genanki.NewNote(model.ID, []string{"Question 1", "Answer 1"}, nil).SetGUID("my-stable-guid")
+	derived := genanki.NewNote(model.ID, []string{"Question 2", "Answer 2"}, nil)
+	deck.AddNote(explicit).AddNote(derived)
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, tmpPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	guids := make(map[int64]string)
+	rows, err := db.Query("SELECT id, guid FROM notes")
+	if err != nil {
+		t.Fatalf("query notes: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var guid string
+		if err := rows.Scan(&id, &guid); err != nil {
+			t.Fatalf("scan note: %v", err)
+		}
+		guids[id] = guid
+	}
+
+	if guids[explicit.ID] != "my-stable-guid" {
+		t.Errorf("Expected explicit GUID to be kept, got %q", guids[explicit.ID])
+	}
+	if expected := genanki.GuidFor("Question 2", "Answer 2"); guids[derived.ID] != expected {
+		t.Errorf("Expected derived GUID %q, got %q", expected, guids[derived.ID])
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestIDNamespace(t *testing.T) {
+	ns := genanki.IDNamespace("spanish-course")
+
+	if ns.DeckID("Verbs") != genanki.IDNamespace("spanish-course").DeckID("Verbs") {
+		t.Error("Expected deck IDs to be stable across calls")
+	}
+	if ns.DeckID("Verbs") == ns.DeckID("Nouns") {
+		t.Error("Expected different deck names to get different IDs")
+	}
+	if ns.DeckID("Verbs") == genanki.IDNamespace("french-course").DeckID("Verbs") {
+		t.Error("Expected different namespaces to get different IDs")
+	}
+
+	basic := ns.NewBasicModel("Spanish Basic")
+	cloze := ns.NewClozeModel("Spanish Cloze")
+	if basic.ID == cloze.ID || basic.ID != ns.ModelID("Spanish Basic") {
+		t.Errorf("Unexpected model IDs %d and %d", basic.ID, cloze.ID)
+	}
+
+	deck := ns.NewDeck("Spanish", "")
+	child := deck.NewSubdeck(0, "Verbs", "")
+	if deck.ID != ns.DeckID("Spanish") || child.ID != ns.DeckID("Spanish::Verbs") {
+		t.Errorf("Expected namespaced deck IDs, got %d and %d", deck.ID, child.ID)
+	}
+}
+
+func TestDuplicateIDsAreReported(t *testing.T) {
+	basic := genanki.StandardBasicModel("Basic")
+	customised := genanki.StandardBasicModel("Basic with CSS")
+	customised.SetCSS(".card { color: red; }")
+
+	deck1 := genanki.StandardDeck("Deck 1", "")
+	deck1.AddNote(genanki.NewNote(basic.ID, []string{"Q1", "A1"}, nil))
+	deck2 := genanki.StandardDeck("Deck 2", "")
+	deck2.AddNote(genanki.NewNote(basic.ID, []string{"Q2", "A2"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck1, deck2}).
+		AddModel(basic.Model).
+		AddModel(customised.Model)
+
+	err := pkg.WriteToFile(tempPackagePath(t))
+
+	var modelErr *genanki.DuplicateModelIDError
+	if !errors.As(err, &modelErr) || modelErr.ModelID != basic.ID || len(modelErr.Names) != 2 {
+		t.Errorf("Expected a duplicate model ID error, got %v", err)
+	}
+
+	var deckErr *genanki.DuplicateDeckIDError
+	if !errors.As(err, &deckErr) || deckErr.DeckID != deck1.ID {
+		t.Errorf("Expected a duplicate deck ID error, got %v", err)
+	}
+}
+
+func TestDuplicateNoteIDsAreReported(t *testing.T) {
+	basic := genanki.NewBasicModel(1234567890, "Basic")
+	uno := genanki.NewNote(basic.ID, []string{"uno", "one"}, nil)
+	uno.ID = 42
+	dos := genanki.NewNote(basic.ID, []string{"dos", "two"}, nil)
+	dos.ID = 42
+
+	deck1 := genanki.NewDeck(1111111111, "Deck 1", "").AddNote(uno)
+	deck2 := genanki.NewDeck(2222222222, "Deck 2", "").AddNote(dos)
+	err := genanki.NewPackage([]*genanki.Deck{deck1, deck2}).AddModel(basic.Model).Validate()
+
+	var noteErr *genanki.DuplicateNoteIDError
+	if !errors.As(err, &noteErr) || noteErr.NoteID != 42 || len(noteErr.GUIDs) != 2 {
+		t.Errorf("Expected a duplicate note ID error, got %v", err)
+	}
+}
+
+func TestIdenticalDuplicatesAreAllowed(t *testing.T) {
+	basic := genanki.StandardBasicModel("Basic")
+	deck := genanki.StandardDeck("Deck", "")
+	deck.AddNote(genanki.NewNote(basic.ID, []string{"Q", "A"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).
+		AddModel(basic.Model).
+		AddModel(genanki.StandardBasicModel("Basic").Model)
+
+	if err := pkg.Validate(); err != nil {
+		t.Errorf("Expected identical models to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func buildMergePackage(model *genanki.BasicModel, deckID int64, deckName string, notes ...*genanki.Note) *genanki.Package {
+	deck := genanki.NewDeck(deckID, deckName, "")
+	for _, note := range notes {
+		deck.AddNote(note)
+	}
+	return genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+}
+
+func TestMergePackages(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Merge Basic")
+
+	first := buildMergePackage(model, 1111111111, "Shared",
+		genanki.NewNote(model.ID, []string{"uno", "one"}, nil),
+		genanki.NewNote(model.ID, []string{"dos", "two"}, nil),
+	)
+	second := buildMergePackage(model, 1111111111, "Shared",
+		genanki.NewNote(model.ID, []string{"dos", "two"}, nil),
+		genanki.NewNote(model.ID, []string{"tres", "three"}, nil),
+	)
+	second.GetDecks()[0].NewSubdeck(2222222222, "Extra", "").
+		AddNote(genanki.NewNote(model.ID, []string{"cuatro", "four"}, nil))
+
+	merged, err := genanki.MergePackages(genanki.GUIDConflictKeepFirst, first, second)
+	if err != nil {
+		t.Fatalf("MergePackages: %v", err)
+	}
+
+	if len(merged.GetModels()) != 1 {
+		t.Errorf("Expected the shared model once, got %d models", len(merged.GetModels()))
+	}
+	decks := merged.GetDecks()
+	if len(decks) != 1 || len(decks[0].Notes) != 3 || len(decks[0].Subdecks) != 1 || len(decks[0].Subdecks[0].Notes) != 1 {
+		t.Fatalf("Expected one deck with 3 notes and a subdeck, got %+v", decks)
+	}
+	if len(first.GetDecks()[0].Notes) != 2 || len(second.GetDecks()[0].Notes) != 2 {
+		t.Error("Expected the merged packages to be left unchanged")
+	}
+	if err := merged.WriteToFile(tempPackagePath(t)); err != nil {
+		t.Errorf("Expected the merged package to write, got %v", err)
+	}
+
+	if _, err := genanki.MergePackages(genanki.GUIDConflictFail, first, second); err == nil {
+		t.Error("Expected a GUID conflict to fail")
+	}
+
+	conflicting := genanki.NewModel(model.ID, "Merge Basic")
+	conflicting.Fields = []genanki.Field{{Name: "Front", Ord: 0}}
+	other := genanki.NewPackage([]*genanki.Deck{}).AddModel(conflicting)
+	if _, err := genanki.MergePackages(genanki.GUIDConflictKeepFirst, first, other); err == nil {
+		t.Error("Expected models with the same ID and different fields to fail")
+	}
+}
+
+func TestMergePackagesKeepNewest(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Merge Basic")
+
+	older := genanki.NewNote(model.ID, []string{"gato", "cat"}, nil)
+	older.GUID = "shared-guid"
+	older.Modified = time.Now().Add(-time.Hour)
+	newer := genanki.NewNote(model.ID, []string{"gato", "cat (animal)"}, nil)
+	newer.GUID = "shared-guid"
+	newer.Modified = time.Now()
+
+	first := buildMergePackage(model, 1111111111, "Old", older)
+	second := buildMergePackage(model, 2222222222, "New", newer)
+
+	merged, err := genanki.MergePackages(genanki.GUIDConflictKeepNewest, first, second)
+	if err != nil {
+		t.Fatalf("MergePackages: %v", err)
+	}
+	decks := merged.GetDecks()
+	if len(decks) != 2 || len(decks[0].Notes) != 0 || len(decks[1].Notes) != 1 {
+		t.Fatalf("Expected the newer note alone in its own deck, got %+v", decks)
+	}
+	if decks[1].Notes[0].Fields[1] != "cat (animal)" {
+		t.Errorf("Expected the newer note, got %v", decks[1].Notes[0].Fields)
+	}
+}
+
+func TestMergePackagesMedia(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Merge Basic")
+
+	first := buildMergePackage(model, 1111111111, "First",
+		genanki.NewNote(model.ID, []string{`<img src="cat.jpg">`, "cat"}, nil),
+	).AddMedia("cat.jpg", []byte("first cat")).AddMedia("shared.mp3", []byte("same"))
+	second := buildMergePackage(model, 2222222222, "Second",
+		genanki.NewNote(model.ID, []string{`<img src='cat.jpg'>`, "[sound:shared.mp3] gato"}, nil),
+	).AddMedia("cat.jpg", []byte("second cat")).AddMedia("shared.mp3", []byte("same"))
+
+	merged, err := genanki.MergePackages(genanki.GUIDConflictKeepFirst, first, second)
+	if err != nil {
+		t.Fatalf("MergePackages: %v", err)
+	}
+
+	if merged.GetMediaCount() != 3 {
+		t.Errorf("Expected 3 media files, got %d", merged.GetMediaCount())
+	}
+	if file := merged.GetMediaFile("cat.jpg"); file == nil || string(file.Data) != "first cat" {
+		t.Errorf("Expected the first package to keep cat.jpg, got %+v", file)
+	}
+
+	fields := merged.GetDecks()[1].Notes[0].Fields
+	if !strings.HasPrefix(fields[0], "<img src='cat_") || strings.Contains(fields[0], "'cat.jpg'") {
+		t.Fatalf("Expected the reference to be renamed, got %q", fields[0])
+	}
+	renamed := strings.TrimSuffix(strings.TrimPrefix(fields[0], "<img src='"), "'>")
+	if file := merged.GetMediaFile(renamed); file == nil || string(file.Data) != "second cat" {
+		t.Errorf("Expected %s to hold the second cat.jpg, got %+v", renamed, file)
+	}
+	if fields[1] != "[sound:shared.mp3] gato" {
+		t.Errorf("Expected identical media to keep its name, got %q", fields[1])
+	}
+	if merged.GetDecks()[0].Notes[0].Fields[0] != `<img src="cat.jpg">` {
+		t.Errorf("Expected the first package's reference to be kept, got %q", merged.GetDecks()[0].Notes[0].Fields[0])
+	}
+}
+
+func TestMergePackagesCopiesSharedObjects(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Merge Basic")
+	opts := genanki.NewDeckOptions(0, "Slow")
+	schedule := &genanki.CardSchedule{Type: genanki.CardTypeReview, Due: time.Now().AddDate(0, 0, 2), Interval: 3}
+
+	deck := genanki.NewDeck(1111111111, "Shared", "").SetOptions(opts)
+	deck.AddNote(genanki.NewNote(model.ID, []string{"uno", "one"}, nil).SetSchedule(0, schedule))
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).
+		AddModel(model.Model).
+		AddFilteredDeck(genanki.NewFilteredDeck(0, "Cram", "deck:Shared", 20, genanki.FilteredRandom))
+
+	merged, err := genanki.MergePackages(genanki.GUIDConflictKeepFirst, pkg)
+	if err != nil {
+		t.Fatalf("MergePackages: %v", err)
+	}
+
+	if _, err := merged.GetModels()[0].SetSortField("Back"); err != nil {
+		t.Fatalf("SetSortField: %v", err)
+	}
+	mergedDeck := merged.GetDecks()[0]
+	mergedDeck.Options.NewPerDay = 99
+	mergedDeck.Notes[0].Schedules[0].Interval = 30
+	merged.GetFilteredDecks()[0].Terms[0].Limit = 5
+
+	if model.SortFieldIndex != 0 || opts.NewPerDay == 99 || schedule.Interval != 3 || pkg.GetFilteredDecks()[0].Terms[0].Limit != 20 {
+		t.Error("Expected changes to the merged package to leave the source package alone")
+	}
+}
+
+func TestMergePackagesMediaWithinPackage(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Merge Basic")
+
+	first := genanki.NewDeck(1111111111, "First", "")
+	first.AddNote(genanki.NewNote(model.ID, []string{`<img src="cat.jpg">`, "cat"}, nil))
+	second := genanki.NewDeck(2222222222, "Second", "")
+	second.AddNote(genanki.NewNote(model.ID, []string{`<img src="cat.jpg">`, "gato"}, nil))
+	second.Media["cat.jpg"] = []byte("deck cat")
+
+	pkg := genanki.NewPackage([]*genanki.Deck{first, second}).
+		AddModel(model.Model).
+		AddMedia("cat.jpg", []byte("package cat"))
+
+	merged, err := genanki.MergePackages(genanki.GUIDConflictKeepFirst, pkg)
+	if err != nil {
+		t.Fatalf("MergePackages: %v", err)
+	}
+
+	if merged.GetMediaCount() != 2 {
+		t.Errorf("Expected both cat.jpg files to be kept, got %d media files", merged.GetMediaCount())
+	}
+	decks := merged.GetDecks()
+	if decks[0].Notes[0].Fields[0] != `<img src="cat.jpg">` {
+		t.Errorf("Expected the package's cat.jpg to keep its name, got %q", decks[0].Notes[0].Fields[0])
+	}
+	renamed := strings.TrimSuffix(strings.TrimPrefix(decks[1].Notes[0].Fields[0], `<img src="`), `">`)
+	if file := merged.GetMediaFile(renamed); renamed == "cat.jpg" || file == nil || string(file.Data) != "deck cat" {
+		t.Errorf("Expected the deck's cat.jpg to be renamed, got %q (%+v)", renamed, file)
+	}
+}
+
+func TestMergePackagesRenumbersCollidingNoteIDs(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Merge Basic")
+
+	uno := genanki.NewNote(model.ID, []string{"uno", "one"}, nil)
+	uno.ID = 42
+	dos := genanki.NewNote(model.ID, []string{"dos", "two"}, nil)
+	dos.ID = 42
+
+	merged, err := genanki.MergePackages(genanki.GUIDConflictKeepFirst,
+		buildMergePackage(model, 1111111111, "First", uno),
+		buildMergePackage(model, 2222222222, "Second", dos),
+	)
+	if err != nil {
+		t.Fatalf("MergePackages: %v", err)
+	}
+
+	decks := merged.GetDecks()
+	if decks[0].Notes[0].ID != 42 || decks[1].Notes[0].ID == 42 {
+		t.Errorf("Expected the second note to get a new ID, got %d and %d", decks[0].Notes[0].ID, decks[1].Notes[0].ID)
+	}
+	if dos.ID != 42 {
+		t.Error("Expected the source note to keep its ID")
+	}
+	if err := merged.WriteToFile(tempPackagePath(t)); err != nil {
+		t.Errorf("Expected the merged package to write, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func newVocabModel() *genanki.Model {
+	model := genanki.NewModel(9876543210, "Vocab")
+	model.Fields = []genanki.Field{{Name: "Word", Ord: 0}, {Name: "Meaning", Ord: 1}, {Name: "Example", Ord: 2}}
+	model.Templates = []genanki.Template{
+		{Name: "Recall", Ord: 0, Qfmt: "{{Meaning}}", Afmt: "{{Word}}"},
+		{Name: "Usage", Ord: 1, Qfmt: "{{Example}}", Afmt: "{{Word}}"},
+	}
+	return model
+}
+
+func TestDatabaseChangeModel(t *testing.T) {
+	db, model, spanish, _ := buildQueryDatabase(t)
+	vocab := newVocabModel()
+	if _, err := db.AddModel(vocab); err != nil {
+		t.Fatalf("AddModel: %v", err)
+	}
+
+	note := genanki.NewNote(model.ID, []string{"perro", "dog"}, []string{"animals"})
+	if _, err := db.AddNote(note); err != nil {
+		t.Fatalf("AddNote: %v", err)
+	}
+	if _, err := db.AddCard(note.ID, spanish.ID, 0); err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+	reviewed := &genanki.CardSchedule{Type: genanki.CardTypeReview, Due: time.Now().AddDate(0, 0, 2), Interval: 5}
+	if _, err := db.AddScheduledCard(note.ID, spanish.ID, 1, reviewed); err != nil {
+		t.Fatalf("AddScheduledCard: %v", err)
+	}
+	before, err := db.CardsByNote(note.ID)
+	if err != nil || len(before) != 2 {
+		t.Fatalf("Expected 2 cards, got %v (%v)", before, err)
+	}
+
+	// The reverse card becomes the Recall card, the forward card is dropped
+	mapping := &genanki.ModelMapping{Fields: []int{0, 1, -1}, Templates: []int{1, -1}}
+	if _, err := db.ChangeModel([]int64{note.ID}, vocab.ID, mapping); err != nil {
+		t.Fatalf("ChangeModel: %v", err)
+	}
+
+	notes, err := db.Notes(nil)
+	if err != nil || len(notes) != 1 {
+		t.Fatalf("Expected 1 note, got %v (%v)", notes, err)
+	}
+	if notes[0].ModelID != vocab.ID || !reflect.DeepEqual(notes[0].Fields, []string{"perro", "dog", ""}) ||
+		!reflect.DeepEqual(notes[0].Tags, []string{"animals"}) {
+		t.Errorf("Unexpected note after changing model %+v", notes[0])
+	}
+
+	after, err := db.CardsByNote(note.ID)
+	if err != nil || len(after) != 1 {
+		t.Fatalf("Expected 1 card, got %v (%v)", after, err)
+	}
+	if after[0].ID != before[1].ID || after[0].Ord != 0 || after[0].Type != genanki.CardTypeReview || after[0].Interval != 5 {
+		t.Errorf("Expected the reviewed card to move to ord 0, got %+v", after[0])
+	}
+
+	if _, err := db.ChangeModel([]int64{note.ID}, vocab.ID, &genanki.ModelMapping{Fields: []int{0, 1}}); err == nil {
+		t.Error("Expected a field mapping of the wrong length to fail")
+	}
+	if _, err := db.ChangeModel([]int64{note.ID}, 42, nil); err == nil {
+		t.Error("Expected an unknown model to fail")
+	}
+}
+
+func TestPackageChangeModel(t *testing.T) {
+	basic := genanki.NewBasicModel(1234567890, "Change Basic")
+	basic.AddTemplate(genanki.Template{Name: "Card 2", Ord: 1, Qfmt: "{{Back}}", Afmt: "{{Front}}"})
+	vocab := newVocabModel()
+
+	reviewed := &genanki.CardSchedule{Type: genanki.CardTypeReview, Due: time.Now().AddDate(0, 0, 2), Interval: 5}
+	note := genanki.NewNote(basic.ID, []string{"gato", "cat"}, nil).
+		SetSchedule(0, &genanki.CardSchedule{}).
+		SetSchedule(1, reviewed)
+	other := genanki.NewNote(vocab.ID, []string{"casa", "house", "mi casa"}, nil)
+	deck := genanki.NewDeck(1111111111, "Change", "").AddNote(note).AddNote(other)
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(basic.Model).AddModel(vocab)
+
+	if err := pkg.ChangeModel([]*genanki.Note{note, other}, vocab.ID, nil); err == nil {
+		t.Error("Expected notes of different models to fail")
+	}
+	if err := pkg.ChangeModel([]*genanki.Note{note}, vocab.ID, &genanki.ModelMapping{Templates: []int{1, 1}}); err == nil {
+		t.Error("Expected a template mapped twice to fail")
+	}
+
+	mapping := &genanki.ModelMapping{Fields: []int{0, 1, -1}, Templates: []int{1, -1}}
+	if err := pkg.ChangeModel([]*genanki.Note{note}, vocab.ID, mapping); err != nil {
+		t.Fatalf("ChangeModel: %v", err)
+	}
+	if note.ModelID != vocab.ID || !reflect.DeepEqual(note.Fields, []string{"gato", "cat", ""}) {
+		t.Errorf("Unexpected note after changing model %+v", note)
+	}
+	if len(note.Schedules) != 1 || note.Schedules[0] != reviewed {
+		t.Errorf("Expected the reviewed schedule on ord 0, got %v", note.Schedules)
+	}
+
+	if err := pkg.Validate(); err != nil {
+		t.Errorf("Expected the changed package to validate, got %v", err)
+	}
+}
+
+func TestPackageChangeModelSortField(t *testing.T) {
+	basic := genanki.NewBasicModel(1234567890, "Change Basic")
+	vocab := newVocabModel()
+	if _, err := vocab.SetSortField("Meaning"); err != nil {
+		t.Fatalf("SetSortField: %v", err)
+	}
+
+	note := genanki.NewNote(basic.ID, []string{"gato", "cat"}, nil)
+	deck := genanki.NewDeck(1111111111, "Change", "").AddNote(note)
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(basic.Model).AddModel(vocab)
+
+	mapping := &genanki.ModelMapping{Fields: []int{1, 0, -1}}
+	if err := pkg.ChangeModel([]*genanki.Note{note}, vocab.ID, mapping); err != nil {
+		t.Fatalf("ChangeModel: %v", err)
+	}
+	expected := genanki.NewNote(vocab.ID, []string{"cat", "gato", ""}, nil)
+	if note.SortField != "gato" || note.CheckSum != expected.CheckSum {
+		t.Errorf("Expected the sort field and checksum of the new fields, got %q and %d", note.SortField, note.CheckSum)
+	}
+}
+
+func TestDatabaseChangeModelGeneratesCards(t *testing.T) {
+	db, model, spanish, _ := buildQueryDatabase(t)
+	vocab := newVocabModel()
+	if _, err := db.AddModel(vocab); err != nil {
+		t.Fatalf("AddModel: %v", err)
+	}
+
+	note := genanki.NewNote(model.ID, []string{"perro", "dog"}, nil)
+	if _, err := db.AddNote(note); err != nil {
+		t.Fatalf("AddNote: %v", err)
+	}
+	if _, err := db.AddCard(note.ID, spanish.ID, 0); err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+
+	// Listing the note twice must not swap its fields back
+	swap := &genanki.ModelMapping{Fields: []int{1, 0}}
+	if _, err := db.ChangeModel([]int64{note.ID, note.ID}, model.ID, swap); err != nil {
+		t.Fatalf("ChangeModel: %v", err)
+	}
+	notes, err := db.Notes(nil)
+	if err != nil || len(notes) != 1 || !reflect.DeepEqual(notes[0].Fields, []string{"dog", "perro"}) {
+		t.Fatalf("Expected the fields swapped once, got %v (%v)", notes, err)
+	}
+
+	// Usage is mapped from no template but its Example field is filled in
+	mapping := &genanki.ModelMapping{Fields: []int{1, 0, 0}, Templates: []int{0, -1}}
+	if _, err := db.ChangeModel([]int64{note.ID}, vocab.ID, mapping); err != nil {
+		t.Fatalf("ChangeModel: %v", err)
+	}
+	cards, err := db.CardsByNote(note.ID)
+	if err != nil || len(cards) != 2 {
+		t.Fatalf("Expected 2 cards, got %v (%v)", cards, err)
+	}
+	if cards[1].Ord != 1 || cards[1].DeckID != spanish.ID || cards[1].Type != genanki.CardTypeNew {
+		t.Errorf("Expected a new Usage card in Spanish, got %+v", cards[1])
+	}
+}
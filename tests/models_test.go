@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"database/sql"
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -231,3 +233,131 @@ func TestConvenienceFunctions(t *testing.T) {
 		t.Errorf("Expected description to match, got %s", deck.Desc)
 	}
 }
+
+func TestModelRequirements(t *testing.T) {
+	model := genanki.NewModel(1234567890, "Requirements Model")
+	model.AddField(genanki.Field{Name: "Image"}).
+		AddField(genanki.Field{Name: "Word"}).
+		AddField(genanki.Field{Name: "Hint"}).
+		AddTemplate(genanki.Template{Name: "Recognise", Qfmt: "{{Word}}<br>{{Hint}}", Afmt: "{{Image}}"}).
+		AddTemplate(genanki.Template{Name: "Produce", Qfmt: "{{#Image}}{{Hint}}{{/Image}}", Afmt: "{{Word}}"})
+
+	deck := genanki.NewDeck(9876543210, "Requirements Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"<img src=cat.jpg>", "gato", "animal"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model)
+	sortField := deck.Notes[0].SortField
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+	if deck.Notes[0].SortField != sortField {
+		t.Errorf("Expected writing to leave the note's SortField alone, got %q", deck.Notes[0].SortField)
+	}
+
+	models := collectionModelsFromAPKG(t, tmpPath)
+	req, err := json.Marshal(models["1234567890"]["req"])
+	if err != nil {
+		t.Fatalf("marshal req: %v", err)
+	}
+
+	expected := `[[0,"any",[1,2]],[1,"all",[0,2]]]`
+	if string(req) != expected {
+		t.Errorf("Expected req %s, got %s", expected, req)
+	}
+}
+
+func collectionModelsFromAPKG(t *testing.T, apkgPath string) map[string]map[string]interface{} {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, apkgPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	var modelsJSON string
+	if err := db.QueryRow("SELECT models FROM col").Scan(&modelsJSON); err != nil {
+		t.Fatalf("query models: %v", err)
+	}
+
+	var models map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(modelsJSON), &models); err != nil {
+		t.Fatalf("unmarshal models: %v", err)
+	}
+	return models
+}
+
+func TestSortField(t *testing.T) {
+	model := genanki.NewModel(1234567890, "Sort Field Model")
+	model.AddField(genanki.Field{Name: "Image"}).
+		AddField(genanki.Field{Name: "Rank"}).
+		AddTemplate(genanki.Template{Name: "Card 1", Qfmt: "{{Image}}", Afmt: "{{Rank}}"})
+
+	if _, err := model.SetSortField("Missing"); err == nil {
+		t.Error("Expected an error for an unknown sort field")
+	}
+	if _, err := model.SetSortField("Rank"); err != nil {
+		t.Fatalf("set sort field: %v", err)
+	}
+	if model.SortFieldIndex != 1 {
+		t.Fatalf("Expected sort field index 1, got %d", model.SortFieldIndex)
+	}
+
+	deck := genanki.NewDeck(9876543210, "Sort Field Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{`<img src="a.jpg">`, "<b>42</b>"}, nil))
+	deck.AddNote(genanki.NewNote(model.ID, []string{`<img src="b.jpg">`, "Top ten"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	models := collectionModelsFromAPKG(t, tmpPath)
+	if sortf := models["1234567890"]["sortf"]; sortf != float64(1) {
+		t.Errorf("Expected sortf 1, got %v", sortf)
+	}
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, tmpPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT typeof(sfld), sfld FROM notes ORDER BY sfld")
+	if err != nil {
+		t.Fatalf("query notes: %v", err)
+	}
+	defer rows.Close()
+
+	expected := [][2]string{{"integer", "42"}, {"text", "Top ten"}}
+	i := 0
+	for ; rows.Next(); i++ {
+		var kind, sfld string
+		if err := rows.Scan(&kind, &sfld); err != nil {
+			t.Fatalf("scan note: %v", err)
+		}
+		if i < len(expected) && (kind != expected[i][0] || sfld != expected[i][1]) {
+			t.Errorf("Expected sfld %v, got [%s %s]", expected[i], kind, sfld)
+		}
+	}
+	if i != len(expected) {
+		t.Errorf("Expected %d notes, got %d", len(expected), i)
+	}
+}
+
+func TestInvalidSortFieldIndex(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Invalid Sort Model")
+	model.SortFieldIndex = 5
+
+	deck := genanki.NewDeck(9876543210, "Invalid Sort Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Front", "Back"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+	if err := pkg.WriteToFile(tempPackagePath(t)); err == nil {
+		t.Fatal("Expected an error for an out of range sort field index")
+	}
+}
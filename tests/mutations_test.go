@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestUpdateNote(t *testing.T) {
+	db, model, spanish, _ := buildQueryDatabase(t)
+
+	note := genanki.NewNote(model.ID, []string{"perro", "dog"}, []string{"animals"})
+	addQueryNote(t, db, note, spanish.ID, nil)
+	guid := genanki.GuidFor(note.Fields...)
+
+	note.Fields[1] = "dog (male)"
+	note.Tags = []string{"animals", "reviewed"}
+	if _, err := db.UpdateNote(note); err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+
+	notes, err := db.Notes(nil)
+	if err != nil || len(notes) != 1 {
+		t.Fatalf("Expected 1 note, got %v (%v)", notes, err)
+	}
+	updated := notes[0]
+	if !reflect.DeepEqual(updated.Fields, []string{"perro", "dog (male)"}) || !reflect.DeepEqual(updated.Tags, []string{"animals", "reviewed"}) {
+		t.Errorf("Expected the new fields and tags, got %+v", updated)
+	}
+	if updated.GUID != guid {
+		t.Errorf("Expected the GUID to be kept, got %q", updated.GUID)
+	}
+
+	missing := genanki.NewNote(model.ID, []string{"gato", "cat"}, nil)
+	if _, err := db.UpdateNote(missing); err == nil {
+		t.Error("Expected UpdateNote to fail for a note not in the collection")
+	}
+}
+
+func TestDeleteNote(t *testing.T) {
+	db, model, spanish, _ := buildQueryDatabase(t)
+
+	kept := genanki.NewNote(model.ID, []string{"uno", "one"}, nil)
+	deleted := genanki.NewNote(model.ID, []string{"dos", "two"}, nil)
+	addQueryNote(t, db, kept, spanish.ID, nil)
+	addQueryNote(t, db, deleted, spanish.ID, nil)
+
+	cards, err := db.CardsByNote(deleted.ID)
+	if err != nil || len(cards) != 2 {
+		t.Fatalf("Expected 2 cards before deleting, got %v (%v)", cards, err)
+	}
+
+	if _, err := db.DeleteNote(deleted.ID); err != nil {
+		t.Fatalf("DeleteNote: %v", err)
+	}
+
+	notes, err := db.Notes(nil)
+	if err != nil || len(notes) != 1 || notes[0].ID != kept.ID {
+		t.Errorf("Expected only the kept note, got %v (%v)", notes, err)
+	}
+	remaining, err := db.Cards(nil)
+	if err != nil || len(remaining) != 2 || remaining[0].NoteID != kept.ID {
+		t.Errorf("Expected only the kept note's cards, got %+v (%v)", remaining, err)
+	}
+
+	if _, err := db.DeleteNote(deleted.ID); err == nil {
+		t.Error("Expected deleting a note twice to fail")
+	}
+
+	// The deletions are recorded in graves for the next sync
+	tmpPath := tempPackagePath(t)
+	if err := genanki.NewPackage(db).WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+	collection := writeTempDB(t, "collection.anki2", readZipEntries(t, tmpPath)["collection.anki2"])
+	rows, err := collection.Query("SELECT oid, type FROM graves ORDER BY type, oid")
+	if err != nil {
+		t.Fatalf("read graves: %v", err)
+	}
+	defer rows.Close()
+
+	graves := make(map[int][]int64)
+	for rows.Next() {
+		var oid int64
+		var graveType int
+		if err := rows.Scan(&oid, &graveType); err != nil {
+			t.Fatalf("scan grave: %v", err)
+		}
+		graves[graveType] = append(graves[graveType], oid)
+	}
+	cardIDs := []int64{cards[0].ID, cards[1].ID}
+	sort.Slice(cardIDs, func(i, j int) bool { return cardIDs[i] < cardIDs[j] })
+	if !reflect.DeepEqual(graves[0], cardIDs) || !reflect.DeepEqual(graves[1], []int64{deleted.ID}) {
+		t.Errorf("Expected graves for the cards %v and note %d, got %v", cardIDs, deleted.ID, graves)
+	}
+}
+
+func TestMoveCards(t *testing.T) {
+	db, model, spanish, french := buildQueryDatabase(t)
+
+	note := genanki.NewNote(model.ID, []string{"rojo", "red"}, nil)
+	addQueryNote(t, db, note, spanish.ID, nil)
+	cards, err := db.CardsByNote(note.ID)
+	if err != nil || len(cards) != 2 {
+		t.Fatalf("Expected 2 cards, got %v (%v)", cards, err)
+	}
+
+	if _, err := db.MoveCards([]int64{cards[1].ID}, french.ID); err != nil {
+		t.Fatalf("MoveCards: %v", err)
+	}
+
+	inFrench, err := db.CardsByDeck(french.ID)
+	if err != nil || len(inFrench) != 1 || inFrench[0].ID != cards[1].ID {
+		t.Errorf("Expected the reverse card in French, got %+v (%v)", inFrench, err)
+	}
+	inSpanish, err := db.CardsByDeck(spanish.ID)
+	if err != nil || len(inSpanish) != 1 || inSpanish[0].ID != cards[0].ID {
+		t.Errorf("Expected the forward card to stay in Spanish, got %+v (%v)", inSpanish, err)
+	}
+
+	if _, err := db.MoveCards([]int64{cards[0].ID}, 42); err == nil {
+		t.Error("Expected moving to an unknown deck to fail")
+	}
+	if _, err := db.MoveCards([]int64{cards[0].ID, 42}, french.ID); err == nil {
+		t.Error("Expected moving an unknown card to fail")
+	}
+	if inSpanish, _ := db.CardsByDeck(spanish.ID); len(inSpanish) != 1 {
+		t.Errorf("Expected a failed move to change nothing, got %d cards in Spanish", len(inSpanish))
+	}
+}
+
+func TestRenameDeck(t *testing.T) {
+	db, _, spanish, french := buildQueryDatabase(t)
+
+	verbs := genanki.NewDeck(3333333333, "Spanish::Verbs", "")
+	irregular := genanki.NewDeck(4444444444, "Spanish::Verbs::Irregular", "")
+	for _, deck := range []*genanki.Deck{verbs, irregular} {
+		if _, err := db.AddDeck(deck); err != nil {
+			t.Fatalf("AddDeck: %v", err)
+		}
+	}
+
+	if _, err := db.RenameDeck(spanish.ID, "Languages::Español"); err != nil {
+		t.Fatalf("RenameDeck: %v", err)
+	}
+
+	decks, err := db.Decks()
+	if err != nil {
+		t.Fatalf("Decks: %v", err)
+	}
+	names := make(map[int64]string)
+	for _, deck := range decks {
+		names[deck.ID] = deck.Name
+	}
+	if names[spanish.ID] != "Languages::Español" || names[verbs.ID] != "Languages::Español::Verbs" ||
+		names[irregular.ID] != "Languages::Español::Verbs::Irregular" || names[french.ID] != "French" {
+		t.Errorf("Unexpected deck names after renaming %v", names)
+	}
+	if len(decks) != 5 {
+		t.Errorf("Expected the Languages parent to be created, got %v", names)
+	}
+
+	if _, err := db.RenameDeck(french.ID, "languages::español"); err == nil {
+		t.Error("Expected renaming onto an existing deck name to fail")
+	}
+	if _, err := db.RenameDeck(spanish.ID, "Languages::Español::Verbs::Mine"); err == nil {
+		t.Error("Expected moving a deck under itself to fail")
+	}
+}
+
+func TestRenameDeckSubdecksIgnoreCase(t *testing.T) {
+	db, _, spanish, _ := buildQueryDatabase(t)
+
+	verbs := genanki.NewDeck(3333333333, "spanish::Verbs", "")
+	if _, err := db.AddDeck(verbs); err != nil {
+		t.Fatalf("AddDeck: %v", err)
+	}
+	if _, err := db.RenameDeck(spanish.ID, "Español"); err != nil {
+		t.Fatalf("RenameDeck: %v", err)
+	}
+
+	decks, err := db.Decks()
+	if err != nil {
+		t.Fatalf("Decks: %v", err)
+	}
+	for _, deck := range decks {
+		if deck.ID == verbs.ID && deck.Name != "Español::Verbs" {
+			t.Errorf("Expected the subdeck to follow its parent, got %q", deck.Name)
+		}
+	}
+}
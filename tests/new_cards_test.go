@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+// newCardPositionsFromAPKG returns the due value of each note's new cards by
+// first field, and the collection's conf.nextPos
+func newCardPositionsFromAPKG(t *testing.T, apkgPath string) (map[string]int64, int64) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, apkgPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT n.flds, c.due FROM cards c JOIN notes n ON n.id = c.nid WHERE c.type = 0")
+	if err != nil {
+		t.Fatalf("query cards: %v", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[string]int64)
+	for rows.Next() {
+		var flds string
+		var due int64
+		if err := rows.Scan(&flds, &due); err != nil {
+			t.Fatalf("scan card: %v", err)
+		}
+		first := strings.Split(flds, "\x1f")[0]
+		if existing, ok := positions[first]; ok && existing != due {
+			t.Errorf("Cards of note %q have positions %d and %d", first, existing, due)
+		}
+		positions[first] = due
+	}
+
+	var nextPos int64
+	if err := db.QueryRow("SELECT json_extract(conf, '$.nextPos') FROM col").Scan(&nextPos); err != nil {
+		t.Fatalf("read nextPos: %v", err)
+	}
+	return positions, nextPos
+}
+
+func buildOrderedPackage() (*genanki.Package, *genanki.BasicModel) {
+	model := genanki.NewBasicModel(1234567890, "Ordered Model")
+	model.AddTemplate(genanki.Template{Name: "Reverse", Qfmt: "{{Back}}", Afmt: "{{Front}}"})
+
+	first := genanki.NewDeck(1111111111, "Lessons::One", "")
+	first.AddNote(genanki.NewNote(model.ID, []string{"10", "ten"}, nil))
+	first.AddNote(genanki.NewNote(model.ID, []string{"2", "two"}, nil))
+	second := genanki.NewDeck(2222222222, "Lessons::Two", "")
+	second.AddNote(genanki.NewNote(model.ID, []string{"apple", "fruit"}, nil))
+	second.AddNote(genanki.NewNote(model.ID, []string{"1", "one"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{first, second}).AddModel(model.Model)
+	return pkg, model
+}
+
+func TestNewCardsInInsertionOrder(t *testing.T) {
+	pkg, _ := buildOrderedPackage()
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	positions, nextPos := newCardPositionsFromAPKG(t, tmpPath)
+	expected := map[string]int64{"10": 1, "2": 2, "apple": 3, "1": 4}
+	for field, pos := range expected {
+		if positions[field] != pos {
+			t.Errorf("Expected note %q at position %d, got %d", field, pos, positions[field])
+		}
+	}
+	if nextPos != 5 {
+		t.Errorf("Expected nextPos 5, got %d", nextPos)
+	}
+}
+
+func TestNewCardsByField(t *testing.T) {
+	pkg, _ := buildOrderedPackage()
+	pkg.OrderNewCardsByField("Front")
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	positions, _ := newCardPositionsFromAPKG(t, tmpPath)
+	expected := map[string]int64{"1": 1, "2": 2, "10": 3, "apple": 4}
+	for field, pos := range expected {
+		if positions[field] != pos {
+			t.Errorf("Expected note %q at position %d, got %d", field, pos, positions[field])
+		}
+	}
+
+	pkg, _ = buildOrderedPackage()
+	if err := pkg.OrderNewCardsByField("Missing").WriteToFile(tempPackagePath(t)); err == nil {
+		t.Error("Expected an error ordering by an unknown field")
+	}
+}
+
+func TestNewCardsByFieldWithNaN(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Ordered Model")
+	values := []string{"NaN", "3", "apple", "1", "Inf"}
+	// NaN and infinities sort as text, whatever order the notes are in
+	expected := map[string]int64{"1": 1, "3": 2, "Inf": 3, "NaN": 4, "apple": 5}
+
+	for _, order := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 0, 4, 1, 3}} {
+		deck := genanki.NewDeck(1111111111, "Numbers", "")
+		for _, i := range order {
+			deck.AddNote(genanki.NewNote(model.ID, []string{values[i], "back"}, nil))
+		}
+		pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).OrderNewCardsByField("Front")
+
+		tmpPath := tempPackagePath(t)
+		if err := pkg.WriteToFile(tmpPath); err != nil {
+			t.Fatalf("write package: %v", err)
+		}
+		positions, _ := newCardPositionsFromAPKG(t, tmpPath)
+		for field, pos := range expected {
+			if positions[field] != pos {
+				t.Errorf("Order %v: expected note %q at position %d, got %d", order, field, pos, positions[field])
+			}
+		}
+	}
+}
+
+func TestShuffledNewCardsAreDeterministic(t *testing.T) {
+	write := func(seed int64) map[string]int64 {
+		pkg, _ := buildOrderedPackage()
+		tmpPath := tempPackagePath(t)
+		if err := pkg.ShuffleNewCards(seed).WriteToFile(tmpPath); err != nil {
+			t.Fatalf("write package: %v", err)
+		}
+		positions, nextPos := newCardPositionsFromAPKG(t, tmpPath)
+		if nextPos != 5 {
+			t.Errorf("Expected nextPos 5, got %d", nextPos)
+		}
+		return positions
+	}
+
+	first := write(42)
+	second := write(42)
+	seen := make(map[int64]bool)
+	for field, pos := range first {
+		if second[field] != pos {
+			t.Errorf("Expected the same position for %q with the same seed, got %d and %d", field, pos, second[field])
+		}
+		seen[pos] = true
+	}
+	for pos := int64(1); pos <= 4; pos++ {
+		if !seen[pos] {
+			t.Errorf("Expected position %d to be assigned, got %v", pos, first)
+		}
+	}
+}
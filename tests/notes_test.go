@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
 	"testing"
 	"time"
 
@@ -43,12 +46,7 @@ func TestNewNote(t *testing.T) {
 	}
 
 	// Check that the checksum is calculated correctly
-	expectedChecksum := int64(0)
-	if len(fields) > 0 {
-		for _, c := range fields[0] {
-			expectedChecksum = (expectedChecksum + int64(c)) % 0xffff
-		}
-	}
+	expectedChecksum := ankiChecksum(fields[0])
 
 	if note.CheckSum != expectedChecksum {
 		t.Errorf("Expected checksum %d, got %d", expectedChecksum, note.CheckSum)
@@ -65,3 +63,116 @@ func TestNewNote(t *testing.T) {
 		t.Errorf("Expected sort field to be '%s', got '%s'", fields[0], note.SortField)
 	}
 }
+
+func TestNoteSortFieldStripsHTML(t *testing.T) {
+	note := genanki.NewNote(1234567890, []string{`<b>Cat</b>&nbsp;<img src="cat.jpg"><!-- hidden -->`, "Back"}, nil)
+
+	expected := "Cat  cat.jpg "
+	if note.SortField != expected {
+		t.Errorf("Expected sort field %q, got %q", expected, note.SortField)
+	}
+	if note.CheckSum != ankiChecksum(expected) {
+		t.Errorf("Expected checksum %d, got %d", ankiChecksum(expected), note.CheckSum)
+	}
+}
+
+// ankiChecksum computes Anki's csum of already stripped text
+func ankiChecksum(text string) int64 {
+	hash := sha1.Sum([]byte(text))
+	csum, _ := strconv.ParseInt(hex.EncodeToString(hash[:])[:8], 16, 64)
+	return csum
+}
+
+func TestNewNoteFromMap(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Named Model")
+	model.AddField(genanki.Field{Name: "Source"})
+
+	note, err := genanki.NewNoteFromMap(model.Model, map[string]string{
+		"Back":  "Paris",
+		"Front": "Capital of France?",
+	}, []string{"geo"})
+	if err != nil {
+		t.Fatalf("new note from map: %v", err)
+	}
+
+	expected := []string{"Capital of France?", "Paris", ""}
+	if len(note.Fields) != len(expected) {
+		t.Fatalf("Expected fields %q, got %q", expected, note.Fields)
+	}
+	for i := range expected {
+		if note.Fields[i] != expected[i] {
+			t.Errorf("Expected fields %q, got %q", expected, note.Fields)
+		}
+	}
+
+	if _, err := genanki.NewNoteFromMap(model.Model, map[string]string{"Front": "Q", "Answer": "A"}, nil); err == nil {
+		t.Error("Expected an error for an unknown field name")
+	}
+	if _, err := genanki.NewNoteFromMap(model.Model, map[string]string{"Back": "A"}, nil); err == nil {
+		t.Error("Expected an error for a missing first field")
+	}
+}
+
+func TestNoteBuilderAndNamedAccess(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Builder Model")
+
+	note, err := genanki.NewNoteBuilder(model.Model).
+		Set("Front", "Hund").
+		Set("Back", "dog").
+		Tags("german", "animals").
+		Build()
+	if err != nil {
+		t.Fatalf("build note: %v", err)
+	}
+	if len(note.Tags) != 2 {
+		t.Errorf("Expected 2 tags, got %v", note.Tags)
+	}
+
+	if err := note.Set(model.Model, "Back", "hound"); err != nil {
+		t.Fatalf("set field: %v", err)
+	}
+	back, err := note.Get(model.Model, "Back")
+	if err != nil {
+		t.Fatalf("get field: %v", err)
+	}
+	if back != "hound" {
+		t.Errorf("Expected Back to be 'hound', got %q", back)
+	}
+
+	if _, err := note.Get(model.Model, "Missing"); err == nil {
+		t.Error("Expected an error for an unknown field name")
+	}
+	if err := note.Set(genanki.NewBasicModel(42, "Other").Model, "Back", "x"); err == nil {
+		t.Error("Expected an error when using a different model")
+	}
+}
+
+func TestNoteSetSortField(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Sorted Model")
+	if _, err := model.SetSortField("Back"); err != nil {
+		t.Fatalf("set sort field: %v", err)
+	}
+
+	note, err := genanki.NewNoteFromMap(model.Model, map[string]string{"Front": "Hund", "Back": "dog"}, nil)
+	if err != nil {
+		t.Fatalf("new note: %v", err)
+	}
+	if note.SortField != "dog" {
+		t.Errorf("Expected the sort field from Back, got %q", note.SortField)
+	}
+
+	if err := note.Set(model.Model, "Back", "hound"); err != nil {
+		t.Fatalf("set field: %v", err)
+	}
+	if note.SortField != "hound" {
+		t.Errorf("Expected the sort field to follow Back, got %q", note.SortField)
+	}
+
+	checksum := note.CheckSum
+	if err := note.Set(model.Model, "Front", "Katze"); err != nil {
+		t.Fatalf("set field: %v", err)
+	}
+	if note.SortField != "hound" || note.CheckSum == checksum {
+		t.Errorf("Expected a new checksum and the same sort field, got %q %d", note.SortField, note.CheckSum)
+	}
+}
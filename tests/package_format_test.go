@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mattn/go-sqlite3"
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+// Schema 18 tables use Anki's unicase collation
+func init() {
+	sql.Register("sqlite3_unicase", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterCollation("unicase", func(a, b string) int {
+				return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+			})
+		},
+	})
+}
+
+func readZipEntries(t *testing.T, apkgPath string) map[string][]byte {
+	t.Helper()
+
+	archive, err := zip.OpenReader(apkgPath)
+	if err != nil {
+		t.Fatalf("open apkg: %v", err)
+	}
+	defer archive.Close()
+
+	entries := make(map[string][]byte)
+	for _, file := range archive.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", file.Name, err)
+		}
+		entries[file.Name] = data
+	}
+	return entries
+}
+
+func writeTempDB(t *testing.T, name string, data []byte) *sql.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	db, err := sql.Open("sqlite3_unicase", path)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWriteLatestFormat(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Modern Basic")
+	opts := genanki.NewDeckOptions(0, "Modern Options")
+	opts.NewPerDay = 7
+	opts.DesiredRetention = 0.85
+
+	deck := genanki.NewDeck(1111111111, "Modern::Deck", "Described").SetOptions(opts)
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Front", `Back <img src="pic.png">`}, []string{"tagged"}))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).
+		AddModel(model.Model).
+		AddMedia("pic.png", []byte("picture bytes")).
+		AddFilteredDeck(genanki.NewFilteredDeck(0, "Cram", "tag:tagged", 10, genanki.FilteredOrderDue)).
+		SetFormat(genanki.FormatLatest)
+
+	tmpPath := tempCollectionPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	entries := readZipEntries(t, tmpPath)
+	if !bytes.Equal(entries["meta"], []byte{0x08, 0x03}) {
+		t.Errorf("Expected meta to declare the latest version, got %v", entries["meta"])
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatalf("zstd decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	collection, err := decoder.DecodeAll(entries["collection.anki21b"], nil)
+	if err != nil {
+		t.Fatalf("decompress collection.anki21b: %v", err)
+	}
+	db := writeTempDB(t, "collection.anki21b", collection)
+
+	var ver int
+	if err := db.QueryRow("SELECT ver FROM col").Scan(&ver); err != nil {
+		t.Fatalf("read ver: %v", err)
+	}
+	if ver != 18 {
+		t.Errorf("Expected schema 18, got %d", ver)
+	}
+
+	var notetype string
+	if err := db.QueryRow("SELECT name FROM notetypes WHERE id = ?", model.ID).Scan(&notetype); err != nil || notetype != "Modern Basic" {
+		t.Errorf("Expected the note type in notetypes, got %q (%v)", notetype, err)
+	}
+	var fieldCount, templateCount int
+	db.QueryRow("SELECT COUNT(*) FROM fields WHERE ntid = ?", model.ID).Scan(&fieldCount)
+	db.QueryRow("SELECT COUNT(*) FROM templates WHERE ntid = ?", model.ID).Scan(&templateCount)
+	if fieldCount != 2 || templateCount != 1 {
+		t.Errorf("Expected 2 fields and 1 template, got %d and %d", fieldCount, templateCount)
+	}
+
+	var deckName string
+	if err := db.QueryRow("SELECT name FROM decks WHERE id = ?", deck.ID).Scan(&deckName); err != nil || deckName != "Modern\x1fDeck" {
+		t.Errorf("Expected the deck name with a \\x1f separator, got %q (%v)", deckName, err)
+	}
+	var tag string
+	if err := db.QueryRow("SELECT tag FROM tags").Scan(&tag); err != nil || tag != "tagged" {
+		t.Errorf("Expected the note's tag in tags, got %q (%v)", tag, err)
+	}
+	var schedVer string
+	if err := db.QueryRow("SELECT val FROM config WHERE KEY = 'schedVer'").Scan(&schedVer); err != nil || schedVer != "2" {
+		t.Errorf("Expected schedVer 2 in config, got %q (%v)", schedVer, err)
+	}
+
+	legacy := writeTempDB(t, "collection.anki2", entries["collection.anki2"])
+	var flds string
+	if err := legacy.QueryRow("SELECT flds FROM notes").Scan(&flds); err != nil || !strings.Contains(flds, "update to the latest Anki") {
+		t.Errorf("Expected the placeholder note in collection.anki2, got %q (%v)", flds, err)
+	}
+
+	media, err := decoder.DecodeAll(entries["0"], nil)
+	if err != nil || string(media) != "picture bytes" {
+		t.Errorf("Expected zstd-compressed media, got %q (%v)", media, err)
+	}
+
+	// The package reads back with the same content
+	read, err := genanki.OpenPackage(tmpPath)
+	if err != nil {
+		t.Fatalf("OpenPackage: %v", err)
+	}
+	readModel := read.GetModel(model.ID)
+	if readModel == nil || !reflect.DeepEqual(readModel.Templates, model.Templates) || readModel.CSS != model.CSS {
+		t.Errorf("Expected the note type to round-trip, got %+v", readModel)
+	}
+
+	var readDeck *genanki.Deck
+	for _, candidate := range read.GetDecks() {
+		if candidate.Name == "Modern::Deck" {
+			readDeck = candidate
+		}
+	}
+	if readDeck == nil || readDeck.Desc != "Described" || len(readDeck.Notes) != 1 {
+		t.Fatalf("Unexpected deck %+v", readDeck)
+	}
+	readOpts := readDeck.Options
+	if readOpts == nil || readOpts.Name != "Modern Options" || readOpts.NewPerDay != 7 || readOpts.DesiredRetention != 0.85 ||
+		!reflect.DeepEqual(readOpts.LearningSteps, opts.LearningSteps) || readOpts.InitialEase != 2500 {
+		t.Errorf("Expected deck options to round-trip, got %+v", readOpts)
+	}
+	if note := readDeck.Notes[0]; note.Fields[0] != "Front" || !reflect.DeepEqual(note.Tags, []string{"tagged"}) {
+		t.Errorf("Unexpected note %+v", note)
+	}
+
+	filtered := read.GetFilteredDecks()
+	if len(filtered) != 1 || filtered[0].Terms[0].Search != "tag:tagged" || filtered[0].Terms[0].Order != genanki.FilteredOrderDue {
+		t.Errorf("Unexpected filtered decks %+v", filtered)
+	}
+	if file := read.GetMediaFile("pic.png"); file == nil || string(file.Data) != "picture bytes" {
+		t.Errorf("Expected media to round-trip, got %+v", file)
+	}
+}
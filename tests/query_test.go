@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func buildQueryDatabase(t *testing.T) (*genanki.Database, *genanki.BasicModel, *genanki.Deck, *genanki.Deck) {
+	t.Helper()
+
+	db, err := genanki.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	model := genanki.NewBasicModel(1234567890, "Query Reversed")
+	model.AddTemplate(genanki.Template{Name: "Card 2", Ord: 1, Qfmt: "{{Back}}", Afmt: "{{FrontSide}}<hr id=answer>{{Front}}"})
+	spanish := genanki.NewDeck(1111111111, "Spanish", "")
+	french := genanki.NewDeck(2222222222, "French", "")
+
+	if _, err := db.AddModel(model.Model); err != nil {
+		t.Fatalf("AddModel: %v", err)
+	}
+	for _, deck := range []*genanki.Deck{spanish, french} {
+		if _, err := db.AddDeck(deck); err != nil {
+			t.Fatalf("AddDeck: %v", err)
+		}
+	}
+	return db, model, spanish, french
+}
+
+func addQueryNote(t *testing.T, db *genanki.Database, note *genanki.Note, deckID int64, schedule *genanki.CardSchedule) {
+	t.Helper()
+
+	if _, err := db.AddNote(note); err != nil {
+		t.Fatalf("AddNote: %v", err)
+	}
+	for ord := 0; ord < 2; ord++ {
+		var cardSchedule *genanki.CardSchedule
+		if ord == 0 {
+			cardSchedule = schedule
+		}
+		if _, err := db.AddScheduledCard(note.ID, deckID, ord, cardSchedule); err != nil {
+			t.Fatalf("AddScheduledCard: %v", err)
+		}
+	}
+}
+
+func TestQueryNotes(t *testing.T) {
+	db, model, spanish, french := buildQueryDatabase(t)
+
+	hola := genanki.NewNote(model.ID, []string{"hola", "hello"}, []string{"Greeting", "spanish"})
+	bonjour := genanki.NewNote(model.ID, []string{"bonjour", "hello"}, []string{"greeting"})
+	addQueryNote(t, db, hola, spanish.ID, nil)
+	addQueryNote(t, db, bonjour, french.ID, nil)
+
+	all, err := db.Notes(nil)
+	if err != nil {
+		t.Fatalf("Notes: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("Expected 2 notes, got %d", len(all))
+	}
+	var read *genanki.Note
+	for _, note := range all {
+		if note.ID == hola.ID {
+			read = note
+		}
+	}
+	if read == nil || read.GUID != genanki.GuidFor(hola.Fields...) || read.ModelID != model.ID {
+		t.Fatalf("Expected hola with its stored IDs, got %+v", read)
+	}
+	if !reflect.DeepEqual(read.Fields, []string{"hola", "hello"}) || !reflect.DeepEqual(read.Tags, []string{"Greeting", "spanish"}) {
+		t.Errorf("Unexpected note %+v", read)
+	}
+
+	inFrench, err := db.Notes(&genanki.NoteFilter{DeckID: french.ID})
+	if err != nil || len(inFrench) != 1 || inFrench[0].ID != bonjour.ID {
+		t.Errorf("Expected only bonjour in French, got %v (%v)", inFrench, err)
+	}
+	greetings, err := db.Notes(&genanki.NoteFilter{Tag: "GREETING"})
+	if err != nil || len(greetings) != 2 {
+		t.Errorf("Expected the tag filter to ignore case, got %v (%v)", greetings, err)
+	}
+	none, err := db.Notes(&genanki.NoteFilter{ModelID: model.ID, Tag: "greet"})
+	if err != nil || len(none) != 0 {
+		t.Errorf("Expected tags to match whole, got %v (%v)", none, err)
+	}
+}
+
+func TestQueryNotesSortField(t *testing.T) {
+	db, _, spanish, _ := buildQueryDatabase(t)
+
+	model := genanki.NewBasicModel(1234567891, "Sorted by Back")
+	if _, err := model.SetSortField("Back"); err != nil {
+		t.Fatalf("SetSortField: %v", err)
+	}
+	if _, err := db.AddModel(model.Model); err != nil {
+		t.Fatalf("AddModel: %v", err)
+	}
+	note := genanki.NewNote(model.ID, []string{"<b>uno</b>", "42"}, nil)
+	checksum := note.CheckSum
+	addQueryNote(t, db, note, spanish.ID, nil)
+
+	notes, err := db.Notes(&genanki.NoteFilter{ModelID: model.ID})
+	if err != nil || len(notes) != 1 {
+		t.Fatalf("Expected 1 note, got %v (%v)", notes, err)
+	}
+	if notes[0].SortField != "42" || notes[0].CheckSum != checksum {
+		t.Errorf("Expected the stored sort field and checksum, got %q and %d", notes[0].SortField, notes[0].CheckSum)
+	}
+}
+
+func TestQueryCards(t *testing.T) {
+	db, model, spanish, french := buildQueryDatabase(t)
+
+	due := time.Now().AddDate(0, 0, 3)
+	reviewed := genanki.NewNote(model.ID, []string{"gato", "cat"}, nil)
+	addQueryNote(t, db, reviewed, spanish.ID, &genanki.CardSchedule{
+		Type:     genanki.CardTypeReview,
+		Due:      due,
+		Interval: 3,
+		Ease:     2500,
+		Flag:     genanki.FlagBlue,
+		Reviews:  []genanki.Review{{Time: time.UnixMilli(1700000000000), Ease: 3, Interval: 3, Factor: 2500}},
+	})
+	fresh := genanki.NewNote(model.ID, []string{"chat", "cat"}, nil)
+	addQueryNote(t, db, fresh, french.ID, nil)
+
+	cards, err := db.CardsByNote(reviewed.ID)
+	if err != nil {
+		t.Fatalf("CardsByNote: %v", err)
+	}
+	if len(cards) != 2 || cards[0].Ord != 0 || cards[1].Ord != 1 {
+		t.Fatalf("Expected both cards of the note in order, got %+v", cards)
+	}
+	card := cards[0]
+	if card.NoteID != reviewed.ID || card.DeckID != spanish.ID || card.Type != genanki.CardTypeReview ||
+		card.Queue != genanki.QueueReview || card.Interval != 3 || card.Flag != genanki.FlagBlue || len(card.Reviews) != 1 {
+		t.Errorf("Unexpected reviewed card %+v", card)
+	}
+	if card.Due.Year() != due.Year() || card.Due.YearDay() != due.YearDay() {
+		t.Errorf("Expected the card due on %v, got %v", due, card.Due)
+	}
+	if cards[1].Type != genanki.CardTypeNew || cards[1].Queue != genanki.QueueNew || !cards[1].Due.IsZero() || len(cards[1].Reviews) != 0 {
+		t.Errorf("Expected a new card, got %+v", cards[1])
+	}
+
+	inFrench, err := db.CardsByDeck(french.ID)
+	if err != nil || len(inFrench) != 2 || inFrench[0].NoteID != fresh.ID {
+		t.Errorf("Expected the French cards, got %+v (%v)", inFrench, err)
+	}
+	reverse, err := db.CardsByOrd(1)
+	if err != nil || len(reverse) != 2 || reverse[0].Ord != 1 || reverse[1].Ord != 1 {
+		t.Errorf("Expected one reverse card per note, got %+v (%v)", reverse, err)
+	}
+	filtered, err := db.Cards(&genanki.CardFilter{DeckID: spanish.ID, Ords: []int{0}})
+	if err != nil || len(filtered) != 1 || filtered[0].ID != card.ID {
+		t.Errorf("Expected filters to combine, got %+v (%v)", filtered, err)
+	}
+}
+
+func TestQueryModelsAndDecks(t *testing.T) {
+	db, model, spanish, _ := buildQueryDatabase(t)
+
+	models, err := db.Models()
+	if err != nil {
+		t.Fatalf("Models: %v", err)
+	}
+	if len(models) != 1 || models[0].ID != model.ID || !reflect.DeepEqual(models[0].Templates, model.Templates) {
+		t.Errorf("Unexpected models %+v", models)
+	}
+
+	decks, err := db.Decks()
+	if err != nil {
+		t.Fatalf("Decks: %v", err)
+	}
+	if len(decks) != 2 || decks[0].ID != spanish.ID || decks[0].Name != "Spanish" {
+		t.Errorf("Unexpected decks %+v", decks)
+	}
+
+	empty, err := genanki.NewDatabase()
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer empty.Close()
+	if models, err := empty.Models(); err != nil || len(models) != 0 {
+		t.Errorf("Expected no models in an empty collection, got %v (%v)", models, err)
+	}
+	if cards, err := empty.Cards(nil); err != nil || len(cards) != 0 {
+		t.Errorf("Expected no cards in an empty collection, got %v (%v)", cards, err)
+	}
+}
@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestOpenPackageRoundTrip(t *testing.T) {
+	basic := genanki.NewBasicModel(1234567890, "Reader Basic")
+	basic.SetCSS(".card { color: red; }")
+	cloze := genanki.NewClozeModel(1234567891, "Reader Cloze")
+
+	opts := genanki.NewDeckOptions(0, "Slow")
+	opts.NewPerDay = 5
+	opts.LearningSteps = []float64{5, 30}
+
+	languages := genanki.NewDeck(1111111111, "Languages", "Top level").SetOptions(opts)
+	verbs := languages.NewSubdeck(2222222222, "Verbs", "Verb drills")
+
+	due := time.Now().AddDate(0, 0, 4)
+	reviewed := genanki.NewNote(basic.ID, []string{"hablar", `to speak <img src="speak.png">`}, []string{"verbs", "spanish"}).
+		SetGUID("custom-guid").
+		SetSchedule(0, &genanki.CardSchedule{
+			Type:     genanki.CardTypeReview,
+			Due:      due,
+			Interval: 6,
+			Ease:     2350,
+			Reps:     3,
+			Reviews:  []genanki.Review{{Time: time.UnixMilli(1700000000000), Ease: 3, Interval: 6, LastInterval: 2, Factor: 2350, Duration: 3 * time.Second, Type: genanki.ReviewReview}},
+		}).
+		SetFlag(genanki.FlagGreen)
+	verbs.AddNote(reviewed)
+	languages.AddNote(genanki.NewNote(cloze.ID, []string{"{{c1::Madrid}} is in {{c2::Spain}}", ""}, nil).Suspend(1))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{languages}).
+		AddModel(basic.Model).
+		AddModel(cloze.Model).
+		AddMedia("speak.png", []byte("png data")).
+		AddFilteredDeck(genanki.NewFilteredDeck(0, "Cram", "deck:Languages", 50, genanki.FilteredRandom))
+
+	tmpPath := tempCollectionPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	read, err := genanki.OpenPackage(tmpPath)
+	if err != nil {
+		t.Fatalf("OpenPackage: %v", err)
+	}
+
+	if len(read.GetModels()) != 2 {
+		t.Fatalf("Expected 2 models, got %d", len(read.GetModels()))
+	}
+	readBasic := read.GetModel(basic.ID)
+	if readBasic == nil || readBasic.Name != "Reader Basic" || readBasic.CSS != basic.CSS {
+		t.Fatalf("Unexpected basic model %+v", readBasic)
+	}
+	if !reflect.DeepEqual(readBasic.Fields, basic.Fields) || !reflect.DeepEqual(readBasic.Templates, basic.Templates) {
+		t.Errorf("Expected fields and templates to round-trip, got %+v and %+v", readBasic.Fields, readBasic.Templates)
+	}
+
+	decks := make(map[string]*genanki.Deck)
+	for _, deck := range read.GetDecks() {
+		decks[deck.Name] = deck
+	}
+	readVerbs := decks["Languages::Verbs"]
+	readLanguages := decks["Languages"]
+	if readVerbs == nil || readLanguages == nil || len(decks) != 2 {
+		t.Fatalf("Expected Languages and Languages::Verbs, got %v", decks)
+	}
+	if readVerbs.ID != verbs.ID || readVerbs.Desc != "Verb drills" {
+		t.Errorf("Unexpected subdeck %+v", readVerbs)
+	}
+	if readLanguages.Options == nil || readLanguages.Options.Name != "Slow" || readLanguages.Options.NewPerDay != 5 ||
+		!reflect.DeepEqual(readLanguages.Options.LearningSteps, []float64{5, 30}) {
+		t.Errorf("Unexpected deck options %+v", readLanguages.Options)
+	}
+
+	if len(readVerbs.Notes) != 1 {
+		t.Fatalf("Expected 1 note in the subdeck, got %d", len(readVerbs.Notes))
+	}
+	note := readVerbs.Notes[0]
+	if note.ID != reviewed.ID || note.GUID != "custom-guid" || note.ModelID != basic.ID {
+		t.Errorf("Unexpected note identity %+v", note)
+	}
+	if !reflect.DeepEqual(note.Fields, reviewed.Fields) || !reflect.DeepEqual(note.Tags, []string{"verbs", "spanish"}) {
+		t.Errorf("Unexpected note content %v %v", note.Fields, note.Tags)
+	}
+
+	schedule := note.Schedules[0]
+	if schedule == nil {
+		t.Fatalf("Expected the review card's schedule to be read")
+	}
+	if schedule.Type != genanki.CardTypeReview || schedule.Queue != genanki.QueueNew || schedule.Interval != 6 ||
+		schedule.Ease != 2350 || schedule.Flag != genanki.FlagGreen || len(schedule.Reviews) != 1 {
+		t.Errorf("Unexpected schedule %+v", schedule)
+	}
+	if schedule.Due.Before(due.Add(-24*time.Hour)) || schedule.Due.After(due) {
+		t.Errorf("Expected due date on the day of %v, got %v", due, schedule.Due)
+	}
+	if schedule.Reviews[0].Time.UnixMilli() != 1700000000000 || schedule.Reviews[0].Duration != 3*time.Second {
+		t.Errorf("Unexpected review %+v", schedule.Reviews[0])
+	}
+
+	if len(readLanguages.Notes) != 1 {
+		t.Fatalf("Expected 1 note in the parent deck, got %d", len(readLanguages.Notes))
+	}
+	clozeNote := readLanguages.Notes[0]
+	if len(clozeNote.Schedules) != 1 || clozeNote.Schedules[1] == nil || clozeNote.Schedules[1].Queue != genanki.QueueSuspended {
+		t.Errorf("Expected only the second cloze card to be suspended, got %v", clozeNote.Schedules)
+	}
+
+	if filtered := read.GetFilteredDecks(); len(filtered) != 1 || filtered[0].Terms[0].Search != "deck:Languages" {
+		t.Errorf("Unexpected filtered decks %+v", filtered)
+	}
+
+	media := read.GetMediaFile("speak.png")
+	if media == nil || !bytes.Equal(media.Data, []byte("png data")) {
+		t.Errorf("Expected media to be read, got %+v", media)
+	}
+
+	// The package can be written again unchanged
+	rewritten := tempCollectionPackagePath(t)
+	if err := read.WriteToFile(rewritten); err != nil {
+		t.Fatalf("rewrite package: %v", err)
+	}
+	again, err := genanki.OpenPackage(rewritten)
+	if err != nil {
+		t.Fatalf("OpenPackage rewritten: %v", err)
+	}
+	if len(again.GetDecks()) != 2 || again.GetMediaCount() != 1 {
+		t.Errorf("Expected the rewritten package to match, got %d decks and %d media files", len(again.GetDecks()), again.GetMediaCount())
+	}
+}
+
+func TestReadPackageFromReader(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Reader Basic")
+	deck := genanki.NewDeck(1111111111, "Reader", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Front", "Back"}, nil))
+
+	tmpPath := tempPackagePath(t)
+	if err := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		t.Fatalf("read package: %v", err)
+	}
+	read, err := genanki.ReadPackage(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadPackage: %v", err)
+	}
+	if decks := read.GetDecks(); len(decks) != 1 || len(decks[0].Notes) != 1 || decks[0].Notes[0].Schedules != nil {
+		t.Errorf("Expected one deck with one new note, got %+v", decks)
+	}
+
+	if _, err := genanki.ReadPackage(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Error("Expected an error reading an invalid archive")
+	}
+}
+
+func TestReadPackageKeepsCardDecks(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Reader Basic")
+	model.AddTemplate(genanki.Template{Name: "Card 2", Ord: 1, Qfmt: "{{Back}}", Afmt: "{{Front}}"})
+	recall := genanki.NewDeck(1111111111, "Recall", "")
+	production := genanki.NewDeck(2222222222, "Production", "")
+
+	note := genanki.NewNote(model.ID, []string{"gato", "cat"}, nil).
+		SetSchedule(1, &genanki.CardSchedule{DeckID: production.ID})
+	recall.AddNote(note)
+
+	tmpPath := tempPackagePath(t)
+	if err := genanki.NewPackage([]*genanki.Deck{recall, production}).AddModel(model.Model).WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	// Reading and writing again must not move the reverse card
+	read, err := genanki.OpenPackage(tmpPath)
+	if err != nil {
+		t.Fatalf("OpenPackage: %v", err)
+	}
+	rewritten := tempPackagePath(t)
+	if err := read.WriteToFile(rewritten); err != nil {
+		t.Fatalf("write read package: %v", err)
+	}
+
+	for _, path := range []string{tmpPath, rewritten} {
+		db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, path))
+		if err != nil {
+			t.Fatalf("open extracted sqlite db: %v", err)
+		}
+		decks := make(map[int]int64)
+		rows, err := db.Query("SELECT ord, did FROM cards WHERE nid = ?", note.ID)
+		if err != nil {
+			t.Fatalf("query cards: %v", err)
+		}
+		for rows.Next() {
+			var ord int
+			var did int64
+			if err := rows.Scan(&ord, &did); err != nil {
+				t.Fatalf("scan card: %v", err)
+			}
+			decks[ord] = did
+		}
+		rows.Close()
+		db.Close()
+
+		if decks[0] != recall.ID || decks[1] != production.ID {
+			t.Errorf("Expected the cards in Recall and Production, got %v", decks)
+		}
+	}
+}
+
+func TestReadPackageAnkiCustomData(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Reader Basic")
+	deck := genanki.NewDeck(1111111111, "Custom", "")
+	note := genanki.NewNote(model.ID, []string{"gato", "cat"}, nil)
+	deck.AddNote(note)
+
+	tmpPath := tempPackagePath(t)
+	if err := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	// Anki stores the custom data as a JSON string inside cards.data
+	collectionPath := extractCollectionDBFromAPKG(t, tmpPath)
+	db, err := sql.Open("sqlite3", collectionPath)
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	_, err = db.Exec(`UPDATE cards SET data = ? WHERE nid = ?`, `{"cd":"{\"lvl\":\"3\",\"n\":2}"}`, note.ID)
+	db.Close()
+	if err != nil {
+		t.Fatalf("update card data: %v", err)
+	}
+	collection, err := os.ReadFile(collectionPath)
+	if err != nil {
+		t.Fatalf("read collection: %v", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{"collection.anki2": collection, "media": []byte("{}")} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	pkg, err := genanki.ReadPackage(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadPackage: %v", err)
+	}
+	schedule := pkg.GetDecks()[0].Notes[0].Schedules[0]
+	if schedule == nil || !reflect.DeepEqual(schedule.CustomData, map[string]string{"lvl": "3", "n": "2"}) {
+		t.Errorf("Expected the card's custom data to be read, got %+v", schedule)
+	}
+}
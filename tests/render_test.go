@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestRenderBasicCard(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Render Model")
+	note := genanki.NewNote(model.ID, []string{"Capital of France?", "Paris"}, []string{"geo"})
+
+	question, answer, err := genanki.RenderCard(model.Model, note, 0)
+	if err != nil {
+		t.Fatalf("render card: %v", err)
+	}
+
+	if !strings.HasPrefix(question, "<style>"+model.CSS+"</style>") {
+		t.Errorf("Expected question to start with the model CSS, got %q", question)
+	}
+	if !strings.HasSuffix(question, `<div class="card card1">Capital of France?</div>`) {
+		t.Errorf("Unexpected question HTML %q", question)
+	}
+	if !strings.HasSuffix(answer, "<div class=\"card card1\">Capital of France?\n\n<hr id=answer>\n\nParis</div>") {
+		t.Errorf("Unexpected answer HTML %q", answer)
+	}
+}
+
+func TestRenderConditionalsAndFilters(t *testing.T) {
+	model := genanki.NewModel(1234567890, "Filter Model")
+	model.AddField(genanki.Field{Name: "Expression"}).
+		AddField(genanki.Field{Name: "Reading"}).
+		AddField(genanki.Field{Name: "Notes"}).
+		AddTemplate(genanki.Template{
+			Name: "Card 1",
+			Qfmt: "{{kanji:Reading}}{{#Notes}} has notes{{/Notes}}{{^Notes}} no notes{{/Notes}}",
+			Afmt: "{{furigana:Reading}}|{{kana:Reading}}|{{text:Expression}}|{{type:Expression}}",
+		})
+	note := genanki.NewNote(model.ID, []string{"<b>日本</b>", "日本[にほん]", ""}, nil)
+
+	question, answer, err := genanki.RenderCard(model, note, 0)
+	if err != nil {
+		t.Fatalf("render card: %v", err)
+	}
+
+	if !strings.Contains(question, ">日本 no notes</div>") {
+		t.Errorf("Unexpected question HTML %q", question)
+	}
+	expected := "<ruby><rb>日本</rb><rt>にほん</rt></ruby>|にほん|日本|<center><code id=typeans>日本</code></center>"
+	if !strings.Contains(answer, expected) {
+		t.Errorf("Expected answer to contain %q, got %q", expected, answer)
+	}
+}
+
+func TestRenderTypeAnswerAndHint(t *testing.T) {
+	model := genanki.NewModel(1234567890, "Type Model")
+	model.AddField(genanki.Field{Name: "Front"}).
+		AddField(genanki.Field{Name: "Back"}).
+		AddField(genanki.Field{Name: "Hint"}).
+		AddTemplate(genanki.Template{
+			Name: "Card 1",
+			Qfmt: "{{Front}}{{hint:Hint}}{{type:Back}}",
+			Afmt: "{{FrontSide}}<hr id=answer>{{Back}}",
+		})
+	note := genanki.NewNote(model.ID, []string{"Dog", "perro", "starts with p"}, nil)
+
+	question, answer, err := genanki.RenderCard(model, note, 0)
+	if err != nil {
+		t.Fatalf("render card: %v", err)
+	}
+
+	if !strings.Contains(question, "<input type=text id=typeans>") {
+		t.Errorf("Expected type-in box on the question, got %q", question)
+	}
+	if !strings.Contains(question, `class=hint style="display: none">starts with p</div>`) {
+		t.Errorf("Expected hidden hint on the question, got %q", question)
+	}
+	if strings.Contains(answer, "typeans") {
+		t.Errorf("Expected FrontSide to drop the type-in box, got %q", answer)
+	}
+}
+
+func TestRenderCloze(t *testing.T) {
+	model := genanki.NewClozeModel(1234567890, "Cloze Model")
+	note := genanki.NewNote(model.ID, []string{"{{c1::Paris::city}} is in {{c2::France}}", "Extra"}, nil)
+
+	question, answer, err := genanki.RenderCard(model.Model, note, 0)
+	if err != nil {
+		t.Fatalf("render card: %v", err)
+	}
+
+	if !strings.Contains(question, `<div class="card card1"><span class="cloze" data-cloze="Paris" data-ordinal="1">[city]</span> is in <span class="cloze-inactive" data-ordinal="2">France</span>`) {
+		t.Errorf("Unexpected cloze question %q", question)
+	}
+	if !strings.Contains(answer, `<span class="cloze" data-ordinal="1">Paris</span> is in`) {
+		t.Errorf("Unexpected cloze answer %q", answer)
+	}
+
+	question, _, err = genanki.RenderCard(model.Model, note, 1)
+	if err != nil {
+		t.Fatalf("render card: %v", err)
+	}
+	if !strings.Contains(question, `<div class="card card2">`) || !strings.Contains(question, `data-ordinal="2">[...]</span>`) {
+		t.Errorf("Unexpected second cloze question %q", question)
+	}
+}
+
+func TestRenderUnknownField(t *testing.T) {
+	model := genanki.NewModel(1234567890, "Broken Model")
+	model.AddField(genanki.Field{Name: "Front"}).
+		AddTemplate(genanki.Template{Name: "Card 1", Qfmt: "{{Missing}}", Afmt: "{{Front}}"})
+	note := genanki.NewNote(model.ID, []string{"Front"}, nil)
+
+	if _, _, err := genanki.RenderCard(model, note, 0); err == nil {
+		t.Fatal("Expected an error for an unknown field reference")
+	}
+	if _, _, err := genanki.RenderCard(model, note, 3); err == nil {
+		t.Fatal("Expected an error for an unknown template ordinal")
+	}
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestScheduledCardsAndReviewLog(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Scheduled Model")
+	deck := genanki.NewDeck(9876543210, "Migrated", "")
+
+	now := time.Now()
+	reviewed := genanki.NewNote(model.ID, []string{"Perro", "Dog"}, nil).
+		SetSchedule(0, &genanki.CardSchedule{
+			Type:     genanki.CardTypeReview,
+			Due:      now.AddDate(0, 0, 10),
+			Interval: 12,
+			Ease:     2300,
+			Reps:     5,
+			Lapses:   1,
+			Reviews: []genanki.Review{
+				{Time: now.AddDate(0, 0, -2), Ease: 3, Interval: 12, LastInterval: 4, Factor: 2300, Duration: 4 * time.Second, Type: genanki.ReviewReview},
+				{Time: now.AddDate(0, 0, -6), Ease: 1, Interval: -600, LastInterval: 10, Factor: 2500, Duration: 8 * time.Second, Type: genanki.ReviewReview},
+			},
+		})
+	learning := genanki.NewNote(model.ID, []string{"Gato", "Cat"}, nil).
+		SetSchedule(0, &genanki.CardSchedule{
+			Type: genanki.CardTypeLearning,
+			Due:  now.Add(10 * time.Minute),
+			Left: 1001,
+		})
+	fresh := genanki.NewNote(model.ID, []string{"Pez", "Fish"}, nil)
+
+	deck.AddNote(reviewed).AddNote(learning).AddNote(fresh)
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", extractCollectionDBFromAPKG(t, tmpPath))
+	if err != nil {
+		t.Fatalf("open extracted sqlite db: %v", err)
+	}
+	defer db.Close()
+
+	var crt int64
+	if err := db.QueryRow("SELECT crt FROM col").Scan(&crt); err != nil {
+		t.Fatalf("read crt: %v", err)
+	}
+
+	var cardID, cardType, queue, due, ivl, factor, reps, lapses int64
+	err = db.QueryRow("SELECT id, type, queue, due, ivl, factor, reps, lapses FROM cards WHERE nid = ?", reviewed.ID).
+		Scan(&cardID, &cardType, &queue, &due, &ivl, &factor, &reps, &lapses)
+	if err != nil {
+		t.Fatalf("read review card: %v", err)
+	}
+	if cardType != 2 || queue != 2 || ivl != 12 || factor != 2300 || reps != 5 || lapses != 1 {
+		t.Errorf("Unexpected review card: type=%d queue=%d ivl=%d factor=%d reps=%d lapses=%d", cardType, queue, ivl, factor, reps, lapses)
+	}
+	// The collection is created now, so a card due in ten days is due on day 10
+	if due != 10 {
+		t.Errorf("Expected review card due on day 10 relative to crt %d, got %d", crt, due)
+	}
+
+	rows, err := db.Query("SELECT id, ease, ivl, lastIvl, time FROM revlog WHERE cid = ? ORDER BY id", cardID)
+	if err != nil {
+		t.Fatalf("read revlog: %v", err)
+	}
+	defer rows.Close()
+
+	type revlogEntry struct{ id, ease, ivl, lastIvl, ms int64 }
+	entries := make([]revlogEntry, 0)
+	for rows.Next() {
+		var entry revlogEntry
+		if err := rows.Scan(&entry.id, &entry.ease, &entry.ivl, &entry.lastIvl, &entry.ms); err != nil {
+			t.Fatalf("scan revlog: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 revlog entries, got %d", len(entries))
+	}
+	if entries[0].id != now.AddDate(0, 0, -6).UnixMilli() || entries[0].ease != 1 || entries[0].ivl != -600 || entries[0].ms != 8000 {
+		t.Errorf("Unexpected first revlog entry %+v", entries[0])
+	}
+	if entries[1].ease != 3 || entries[1].ivl != 12 || entries[1].lastIvl != 4 {
+		t.Errorf("Unexpected second revlog entry %+v", entries[1])
+	}
+
+	var left int64
+	err = db.QueryRow("SELECT type, queue, due, left FROM cards WHERE nid = ?", learning.ID).Scan(&cardType, &queue, &due, &left)
+	if err != nil {
+		t.Fatalf("read learning card: %v", err)
+	}
+	if cardType != 1 || queue != 1 || due != now.Add(10*time.Minute).Unix() || left != 1001 {
+		t.Errorf("Unexpected learning card: type=%d queue=%d due=%d left=%d", cardType, queue, due, left)
+	}
+
+	err = db.QueryRow("SELECT type, queue, ivl, factor FROM cards WHERE nid = ?", fresh.ID).Scan(&cardType, &queue, &ivl, &factor)
+	if err != nil {
+		t.Fatalf("read new card: %v", err)
+	}
+	if cardType != 0 || queue != 0 || ivl != 0 || factor != 2500 {
+		t.Errorf("Unexpected new card: type=%d queue=%d ivl=%d factor=%d", cardType, queue, ivl, factor)
+	}
+}
+
+func TestInvalidScheduleFailsValidation(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Scheduled Model")
+	deck := genanki.NewDeck(9876543210, "Migrated", "")
+
+	note := genanki.NewNote(model.ID, []string{"Perro", "Dog"}, nil).
+		SetSchedule(0, &genanki.CardSchedule{Type: genanki.CardTypeReview, Interval: 3}).
+		SetSchedule(4, &genanki.CardSchedule{Type: genanki.CardTypeReview, Due: time.Now()})
+	deck.AddNote(note)
+
+	err := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model).Validate()
+
+	var validationErr *genanki.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", validationErr.Problems)
+	}
+	for i, ord := range []int{0, 4} {
+		var scheduleErr *genanki.ScheduleError
+		if !errors.As(validationErr.Problems[i], &scheduleErr) || scheduleErr.Ord != ord {
+			t.Errorf("Expected a ScheduleError for card %d, got %v", ord, validationErr.Problems[i])
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func buildSearchPackage() *genanki.Package {
+	basic := genanki.NewBasicModel(1234567890, "Search Basic")
+	basic.AddTemplate(genanki.Template{Name: "Card 2", Ord: 1, Qfmt: "{{Back}}", Afmt: "{{FrontSide}}<hr id=answer>{{Front}}"})
+	cloze := genanki.NewClozeModel(1234567891, "Search Cloze")
+
+	bio := genanki.NewDeck(1111111111, "Bio", "")
+	cells := bio.NewSubdeck(2222222222, "Cells", "")
+	chem := genanki.NewDeck(3333333333, "Chem", "")
+
+	cells.AddNote(genanki.NewNote(basic.ID, []string{"Mitochondria", "powerhouse of the cell"}, []string{"exam"}))
+	cells.AddNote(genanki.NewNote(basic.ID, []string{"Ribosome", "protein factory"}, []string{"exam::final"}).Suspend())
+	chem.AddNote(genanki.NewNote(basic.ID, []string{"Water", "H2O"}, nil).SetFlag(genanki.FlagRed))
+	bio.AddNote(genanki.NewNote(cloze.ID, []string{"{{c1::Mitosis}} splits {{c2::cells}}", ""}, []string{"Exam"}))
+
+	return genanki.NewPackage([]*genanki.Deck{bio, chem}).
+		AddModel(basic.Model).
+		AddModel(cloze.Model)
+}
+
+// openSearchDatabase writes pkg and opens its collection as a Database
+func openSearchDatabase(t *testing.T, pkg *genanki.Package) *genanki.Database {
+	t.Helper()
+
+	tmpPath := tempPackagePath(t)
+	if err := pkg.WriteToFile(tmpPath); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+	collectionPath := filepath.Join(t.TempDir(), "collection.anki2")
+	if err := os.WriteFile(collectionPath, readZipEntries(t, tmpPath)["collection.anki2"], 0o600); err != nil {
+		t.Fatalf("write collection: %v", err)
+	}
+
+	db, err := genanki.OpenDatabase(collectionPath)
+	if err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func sortedFronts(notes []*genanki.Note) []string {
+	fronts := make([]string, 0, len(notes))
+	for _, note := range notes {
+		fronts = append(fronts, note.Fields[0])
+	}
+	sort.Strings(fronts)
+	return fronts
+}
+
+func TestSearchNotes(t *testing.T) {
+	pkg := buildSearchPackage()
+	db := openSearchDatabase(t, pkg)
+
+	const mitosis = "{{c1::Mitosis}} splits {{c2::cells}}"
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"deck:Bio::Cells tag:exam -is:suspended front:*mito*", []string{"Mitochondria"}},
+		{"deck:bio", []string{"Mitochondria", "Ribosome", mitosis}},
+		{"deck:Bio::*", []string{"Mitochondria", "Ribosome"}},
+		{"tag:exam", []string{"Mitochondria", "Ribosome", mitosis}},
+		{"tag:exam::*", []string{"Ribosome"}},
+		{"tag:none", []string{"Water"}},
+		{"is:suspended", []string{"Ribosome"}},
+		{"flag:1", []string{"Water"}},
+		{"water OR ribosome", []string{"Ribosome", "Water"}},
+		{"(deck:Chem or tag:exam::final) -h2o", []string{"Ribosome"}},
+		{`"note:Search Cloze"`, []string{mitosis}},
+		{`card:"Card 2"`, []string{"Mitochondria", "Ribosome", "Water"}},
+		{"card:cloze", []string{mitosis}},
+		{"re:^mito", []string{"Mitochondria"}},
+		{"back:protein*", []string{"Ribosome"}},
+		{"back:protein", nil},
+		{"text:re:splits", []string{mitosis}},
+		{"mito", []string{"Mitochondria", mitosis}},
+		{"c_lls", []string{mitosis}},
+		{`"of the cell"`, []string{"Mitochondria"}},
+		{"", []string{"Mitochondria", "Ribosome", "Water", mitosis}},
+	}
+
+	for _, test := range tests {
+		want := test.want
+		if want == nil {
+			want = []string{}
+		}
+
+		notes, err := pkg.FindNotes(test.query)
+		if err != nil {
+			t.Errorf("Package.FindNotes(%q): %v", test.query, err)
+		} else if got := sortedFronts(notes); !reflect.DeepEqual(got, want) {
+			t.Errorf("Package.FindNotes(%q) = %q, want %q", test.query, got, want)
+		}
+
+		notes, err = db.FindNotes(test.query)
+		if err != nil {
+			t.Errorf("Database.FindNotes(%q): %v", test.query, err)
+		} else if got := sortedFronts(notes); !reflect.DeepEqual(got, want) {
+			t.Errorf("Database.FindNotes(%q) = %q, want %q", test.query, got, want)
+		}
+	}
+}
+
+func TestSearchCards(t *testing.T) {
+	pkg := buildSearchPackage()
+	db := openSearchDatabase(t, pkg)
+
+	for _, query := range []string{`card:"Card 2" is:new`, "card:2 -is:suspended"} {
+		pkgCards, err := pkg.FindCards(query)
+		if err != nil {
+			t.Fatalf("Package.FindCards(%q): %v", query, err)
+		}
+		dbCards, err := db.FindCards(query)
+		if err != nil {
+			t.Fatalf("Database.FindCards(%q): %v", query, err)
+		}
+		if len(pkgCards) != 3 || len(dbCards) != 3 {
+			t.Errorf("Expected 3 cards for %q, got %d in the package and %d in the database", query, len(pkgCards), len(dbCards))
+		}
+		for _, card := range dbCards {
+			if card.Ord != 1 {
+				t.Errorf("Expected only second cards for %q, got ord %d", query, card.Ord)
+			}
+		}
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	for _, query := range []string{"deck:", "(tag:exam", "tag:exam)", "water or", "and water", "is:due", "prop:ivl>3", `"unterminated`, "flag:9", "re:(", "card:0"} {
+		if _, err := genanki.ParseSearch(query); err == nil {
+			t.Errorf("Expected ParseSearch(%q) to fail", query)
+		}
+	}
+}
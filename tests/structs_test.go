@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+type vocab struct {
+	Word    string   `anki:"Word"`
+	Meaning string   `anki:"Meaning"`
+	Example string   `anki:"Example Sentence"`
+	Tags    []string `anki:",tags"`
+	Notes   string
+}
+
+func TestModelFromStruct(t *testing.T) {
+	model, err := genanki.ModelFromStruct[vocab]("Vocab")
+	if err != nil {
+		t.Fatalf("model from struct: %v", err)
+	}
+
+	expected := []string{"Word", "Meaning", "Example Sentence"}
+	if len(model.Fields) != len(expected) {
+		t.Fatalf("Expected %d fields, got %d", len(expected), len(model.Fields))
+	}
+	for i, name := range expected {
+		if model.Fields[i].Name != name || model.Fields[i].Ord != i {
+			t.Errorf("Expected field %d to be %q, got %q (ord %d)", i, name, model.Fields[i].Name, model.Fields[i].Ord)
+		}
+	}
+
+	if len(model.Templates) != 1 || model.Templates[0].Qfmt != "{{Word}}" {
+		t.Errorf("Unexpected templates %+v", model.Templates)
+	}
+
+	again, err := genanki.ModelFromStruct[vocab]("Vocab")
+	if err != nil {
+		t.Fatalf("model from struct: %v", err)
+	}
+	if model.ID != again.ID {
+		t.Errorf("Expected a deterministic model ID, got %d and %d", model.ID, again.ID)
+	}
+
+	other, err := genanki.ModelFromStruct[vocab]("Other Vocab")
+	if err != nil {
+		t.Fatalf("model from struct: %v", err)
+	}
+	if model.ID == other.ID {
+		t.Errorf("Expected different names to give different model IDs")
+	}
+}
+
+func TestNotesFromStructs(t *testing.T) {
+	model, err := genanki.ModelFromStruct[vocab]("Vocab")
+	if err != nil {
+		t.Fatalf("model from struct: %v", err)
+	}
+
+	notes, err := genanki.NotesFromStructs(model, []vocab{
+		{Word: "gato", Meaning: "cat", Tags: []string{"animals"}},
+		{Word: "perro", Meaning: "dog", Example: "El perro ladra.", Tags: []string{"animals", "common"}},
+	})
+	if err != nil {
+		t.Fatalf("notes from structs: %v", err)
+	}
+
+	if len(notes) != 2 {
+		t.Fatalf("Expected 2 notes, got %d", len(notes))
+	}
+	if notes[1].Fields[0] != "perro" || notes[1].Fields[1] != "dog" || notes[1].Fields[2] != "El perro ladra." {
+		t.Errorf("Unexpected fields %q", notes[1].Fields)
+	}
+	if len(notes[1].Tags) != 2 || notes[1].Tags[1] != "common" {
+		t.Errorf("Unexpected tags %q", notes[1].Tags)
+	}
+	if notes[0].ModelID != model.ID {
+		t.Errorf("Expected model ID %d, got %d", model.ID, notes[0].ModelID)
+	}
+
+	if _, err := genanki.NotesFromStructs(model, []vocab{{Meaning: "no word"}}); err == nil {
+		t.Error("Expected an error for a missing first field")
+	}
+}
+
+type Extra struct {
+	Back string `anki:"Back"`
+}
+
+type embeddedCard struct {
+	Front string `anki:"Front"`
+	*Extra
+}
+
+func TestNotesFromStructsNilEmbeddedPointer(t *testing.T) {
+	model, err := genanki.ModelFromStruct[embeddedCard]("Embedded")
+	if err != nil {
+		t.Fatalf("model from struct: %v", err)
+	}
+
+	notes, err := genanki.NotesFromStructs(model, []embeddedCard{
+		{Front: "gato"},
+		{Front: "perro", Extra: &Extra{Back: "dog"}},
+	})
+	if err != nil {
+		t.Fatalf("notes from structs: %v", err)
+	}
+	if notes[0].Fields[1] != "" || notes[1].Fields[1] != "dog" {
+		t.Errorf("Expected an empty Back behind the nil pointer, got %q and %q", notes[0].Fields, notes[1].Fields)
+	}
+}
+
+func TestModelFromStructRejectsInvalidTags(t *testing.T) {
+	type untagged struct {
+		Word string
+	}
+	if _, err := genanki.ModelFromStruct[untagged]("Untagged"); err == nil {
+		t.Error("Expected an error for a struct without anki tags")
+	}
+
+	type badTags struct {
+		Word string `anki:"Word"`
+		Tags string `anki:",tags"`
+	}
+	if _, err := genanki.ModelFromStruct[badTags]("Bad Tags"); err == nil {
+		t.Error("Expected an error for a non-slice tags field")
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	genanki "github.com/npcnixel/genanki-go"
+)
+
+func TestValidateValidPackage(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Valid Model")
+	deck := genanki.NewDeck(9876543210, "Valid Deck", "")
+	deck.AddNote(genanki.NewNote(model.ID, []string{"Front", "Back"}, nil))
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+	if err := pkg.Validate(); err != nil {
+		t.Errorf("Expected package to be valid, got %v", err)
+	}
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	model := genanki.NewBasicModel(1234567890, "Broken Model")
+	model.AddTemplate(genanki.Template{Name: "Reverse", Qfmt: "{{Bakc}}", Afmt: "{{FrontSide}}"})
+
+	deck := genanki.NewDeck(9876543210, "Broken Deck", "")
+	unknownModel := genanki.NewNote(1111111111, []string{"Front", "Back"}, nil)
+	shortNote := genanki.NewNote(model.ID, []string{"Front only"}, nil)
+	emptyNote := genanki.NewNote(model.ID, []string{" <br>", "Back"}, nil)
+	noFields := genanki.NewNote(model.ID, []string{}, nil)
+	deck.AddNote(unknownModel).AddNote(shortNote).AddNote(emptyNote).AddNote(noFields)
+
+	pkg := genanki.NewPackage([]*genanki.Deck{deck}).AddModel(model.Model)
+	err := pkg.Validate()
+
+	var validationErr *genanki.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 6 {
+		t.Errorf("Expected 6 problems, got %d: %v", len(validationErr.Problems), validationErr)
+	}
+
+	var refErr *genanki.UnknownFieldReferenceError
+	if !errors.As(err, &refErr) || refErr.Field != "Bakc" || refErr.Template != "Reverse" {
+		t.Errorf("Expected an unknown field reference to Bakc, got %v", refErr)
+	}
+
+	var modelErr *genanki.UnknownModelError
+	if !errors.As(err, &modelErr) || modelErr.NoteID != unknownModel.ID {
+		t.Errorf("Expected an unknown model error for note %d, got %v", unknownModel.ID, modelErr)
+	}
+
+	var countErr *genanki.FieldCountError
+	if !errors.As(err, &countErr) || countErr.NoteID != shortNote.ID || countErr.Expected != 2 || countErr.Actual != 1 {
+		t.Errorf("Expected a field count error for note %d, got %v", shortNote.ID, countErr)
+	}
+
+	var emptyErr *genanki.EmptyFirstFieldError
+	if !errors.As(err, &emptyErr) || emptyErr.NoteID != emptyNote.ID {
+		t.Errorf("Expected an empty first field error for note %d, got %v", emptyNote.ID, emptyErr)
+	}
+
+	if writeErr := pkg.WriteToFile(tempPackagePath(t)); !errors.As(writeErr, &validationErr) {
+		t.Errorf("Expected WriteToFile to fail validation, got %v", writeErr)
+	}
+}
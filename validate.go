@@ -0,0 +1,290 @@
+package genanki
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// specialFields are the template replacements Anki provides besides note fields
+var specialFields = map[string]bool{
+	"FrontSide": true,
+	"Tags":      true,
+	"Type":      true,
+	"Deck":      true,
+	"Subdeck":   true,
+	"Card":      true,
+	"CardFlag":  true,
+}
+
+// ValidationError reports every problem found by Package.Validate. Each
+// problem is one of the typed errors below, so callers can pick them out with
+// errors.As.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.Error()
+	}
+	return fmt.Sprintf("package has %d problem(s): %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+// Unwrap exposes the individual problems to errors.Is and errors.As
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// UnknownModelError reports a note whose model was not added to the package
+type UnknownModelError struct {
+	NoteID  int64
+	ModelID int64
+}
+
+func (e *UnknownModelError) Error() string {
+	return fmt.Sprintf("note %d references unknown model %d", e.NoteID, e.ModelID)
+}
+
+// FieldCountError reports a note with a different number of fields than its model
+type FieldCountError struct {
+	NoteID   int64
+	ModelID  int64
+	Expected int
+	Actual   int
+}
+
+func (e *FieldCountError) Error() string {
+	return fmt.Sprintf("note %d has %d field(s) but model %d has %d", e.NoteID, e.Actual, e.ModelID, e.Expected)
+}
+
+// EmptyFirstFieldError reports a note whose first field is empty, which Anki
+// refuses to import
+type EmptyFirstFieldError struct {
+	NoteID int64
+}
+
+func (e *EmptyFirstFieldError) Error() string {
+	return fmt.Sprintf("note %d has an empty first field", e.NoteID)
+}
+
+// UnknownFieldReferenceError reports a template that refers to a field the
+// model does not have
+type UnknownFieldReferenceError struct {
+	ModelID  int64
+	Template string
+	Field    string
+}
+
+func (e *UnknownFieldReferenceError) Error() string {
+	return fmt.Sprintf("template %q of model %d references unknown field %q", e.Template, e.ModelID, e.Field)
+}
+
+// TemplateSyntaxError reports a template that cannot be parsed
+type TemplateSyntaxError struct {
+	ModelID  int64
+	Template string
+	Err      error
+}
+
+func (e *TemplateSyntaxError) Error() string {
+	return fmt.Sprintf("template %q of model %d is invalid: %v", e.Template, e.ModelID, e.Err)
+}
+
+func (e *TemplateSyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// FilteredDeckError reports a filtered deck with invalid search terms
+type FilteredDeckError struct {
+	DeckID int64
+	Err    error
+}
+
+func (e *FilteredDeckError) Error() string {
+	return fmt.Sprintf("filtered deck %d is invalid: %v", e.DeckID, e.Err)
+}
+
+func (e *FilteredDeckError) Unwrap() error {
+	return e.Err
+}
+
+// ScheduleError reports an invalid initial card state, such as a review card
+// without a due date or an unknown flag, or a schedule for a card the note
+// does not generate
+type ScheduleError struct {
+	NoteID int64
+	Ord    int
+	Err    error
+}
+
+func (e *ScheduleError) Error() string {
+	return fmt.Sprintf("schedule of note %d card %d is invalid: %v", e.NoteID, e.Ord, e.Err)
+}
+
+func (e *ScheduleError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the package's notes against their models and returns a
+// *ValidationError listing every problem, or nil if the package is valid.
+func (p *Package) Validate() error {
+	problems := make([]error, 0)
+
+	modelsByID := make(map[int64]*Model, len(p.models))
+	for _, model := range p.models {
+		modelsByID[model.ID] = model
+		problems = append(problems, validateModel(model)...)
+	}
+	problems = append(problems, duplicateModelIDs(p.models)...)
+
+	decks := flattenDecks(p.decks)
+	problems = append(problems, duplicateDeckIDs(decks, p.filteredDecks)...)
+
+	options := append([]*DeckOptions{}, p.deckOptions...)
+	for _, deck := range decks {
+		if deck.Options != nil {
+			options = append(options, deck.Options)
+		}
+	}
+	problems = append(problems, duplicateDeckOptionsIDs(options)...)
+
+	deckIDs := make(map[int64]bool, len(decks))
+	notes := make([]*Note, 0)
+	for _, deck := range decks {
+		deckIDs[deck.ID] = true
+		notes = append(notes, deck.Notes...)
+	}
+	problems = append(problems, duplicateNoteIDs(notes)...)
+	for _, deck := range decks {
+		if _, err := NormalizeDeckName(deck.Name); err != nil {
+			problems = append(problems, &InvalidDeckNameError{DeckID: deck.ID, Name: deck.Name})
+		}
+		for _, note := range deck.Notes {
+			problems = append(problems, validateNote(note, modelsByID)...)
+			for ord, schedule := range note.Schedules {
+				if schedule != nil && schedule.DeckID != 0 && !deckIDs[schedule.DeckID] {
+					problems = append(problems, &ScheduleError{NoteID: note.ID, Ord: ord, Err: fmt.Errorf("deck %d is not in the package", schedule.DeckID)})
+				}
+			}
+		}
+	}
+
+	for _, filtered := range p.filteredDecks {
+		if _, err := NormalizeDeckName(filtered.Name); err != nil {
+			problems = append(problems, &InvalidDeckNameError{DeckID: filtered.ID, Name: filtered.Name})
+		}
+		if err := filtered.validate(); err != nil {
+			problems = append(problems, &FilteredDeckError{DeckID: filtered.ID, Err: err})
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validateModel(model *Model) []error {
+	problems := make([]error, 0)
+
+	fieldNames := make(map[string]bool, len(model.Fields))
+	for _, field := range model.Fields {
+		fieldNames[field.Name] = true
+	}
+
+	for _, template := range model.Templates {
+		for _, format := range []string{template.Qfmt, template.Afmt} {
+			nodes, err := parseTemplate(format)
+			if err != nil {
+				problems = append(problems, &TemplateSyntaxError{ModelID: model.ID, Template: template.Name, Err: err})
+				continue
+			}
+
+			for _, key := range templateFieldReferences(nodes) {
+				if !fieldNames[key] && !specialFields[key] {
+					problems = append(problems, &UnknownFieldReferenceError{ModelID: model.ID, Template: template.Name, Field: key})
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+func validateNote(note *Note, modelsByID map[int64]*Model) []error {
+	problems := make([]error, 0)
+
+	model, ok := modelsByID[note.ModelID]
+	if !ok {
+		problems = append(problems, &UnknownModelError{NoteID: note.ID, ModelID: note.ModelID})
+	} else if len(note.Fields) != len(model.Fields) {
+		problems = append(problems, &FieldCountError{
+			NoteID:   note.ID,
+			ModelID:  model.ID,
+			Expected: len(model.Fields),
+			Actual:   len(note.Fields),
+		})
+	}
+
+	if len(note.Fields) == 0 || emptyFieldRegexp.MatchString(note.Fields[0]) {
+		problems = append(problems, &EmptyFirstFieldError{NoteID: note.ID})
+	}
+
+	if note.hasCardState() {
+		generated := make(map[int]bool)
+		if ok && len(note.Fields) == len(model.Fields) {
+			if ords, err := cardOrdinals(model, note); err == nil {
+				for _, ord := range ords {
+					generated[ord] = true
+				}
+			}
+		}
+
+		ords := make([]int, 0, len(generated)+len(note.Schedules))
+		for ord := range generated {
+			ords = append(ords, ord)
+		}
+		for ord := range note.Schedules {
+			if !generated[ord] {
+				ords = append(ords, ord)
+			}
+		}
+		sort.Ints(ords)
+
+		for _, ord := range ords {
+			if err := note.cardState(ord, 0).validate(); err != nil {
+				problems = append(problems, &ScheduleError{NoteID: note.ID, Ord: ord, Err: err})
+			} else if ok && !generated[ord] {
+				problems = append(problems, &ScheduleError{NoteID: note.ID, Ord: ord, Err: fmt.Errorf("note has no card %d", ord)})
+			}
+		}
+	}
+
+	return problems
+}
+
+// templateFieldReferences returns the keys referenced by nodes, in order of
+// first appearance
+func templateFieldReferences(nodes []templateNode) []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+
+	var walk func(nodes []templateNode)
+	walk = func(nodes []templateNode) {
+		for _, node := range nodes {
+			if node.kind == textNode {
+				continue
+			}
+			if !seen[node.key] {
+				seen[node.key] = true
+				keys = append(keys, node.key)
+			}
+			walk(node.children)
+		}
+	}
+	walk(nodes)
+
+	return keys
+}